@@ -13,11 +13,25 @@ import (
 )
 
 type GetChainId func() utils.ChainId
+type GetPrivateKey func() (string, error)
+// return an error to refuse operations before they are signed, or a function called with whether
+// the transaction may be applied, e.g. a spending policy only counts transfers not rejected
+type CheckOperations func(ops []interface{}) (func(applied bool), error)
 
 type Account struct {
 	Name string
-	PrivateKey string
 	GetChainIdCallBack GetChainId
+	Mode Mode
+	// Deprecated: set by NewAccount and used to sign if the account isn't created by NewWalletAccount.
+	// an account of a wallet has no key itself and leaves it empty, get the key by wallet ExportPrivateKey
+	PrivateKey string
+	// set by NewWalletAccount, private key is fetched by it when signing, e.g. a wallet can refuse to sign when locked
+	getPrivateKeyCallBack GetPrivateKey
+	// set by NewWalletAccount, every operation is checked by it before signing,
+	// e.g. a wallet enforces spending policies of accounts
+	checkOperationsCallBack CheckOperations
+	// set by DryRun, called with the estimation of a transaction in ModeDryRun
+	estimated func(e *Estimate)
 }
 
 func NewAccount(name, privateKey string, callBack GetChainId) *Account {
@@ -28,6 +42,17 @@ func NewAccount(name, privateKey string, callBack GetChainId) *Account {
 	}
 }
 
+// create an account whose key is kept by a wallet, the key is fetched by privateKey for every signing,
+// and operations are checked by check before signing. callbacks can't be changed once created
+func NewWalletAccount(name string, chainId GetChainId, privateKey GetPrivateKey, check CheckOperations) *Account {
+	return &Account{
+		Name:name,
+		GetChainIdCallBack:chainId,
+		getPrivateKeyCallBack:privateKey,
+		checkOperationsCallBack:check,
+	}
+}
+
 func (a *Account) CreateAccount(fee uint64, newAccountName, pubKeyStr, meta string) (*grpcpb.BroadcastTrxResponse,error) {
 	pubKey, _ := prototype.PublicKeyFromWIF(pubKeyStr)
 	acOp := &prototype.AccountCreateOperation{
@@ -38,7 +63,7 @@ func (a *Account) CreateAccount(fee uint64, newAccountName, pubKeyStr, meta stri
 		JsonMetadata:meta,
 	}
 
-	return a.broadcastTrx(a.PrivateKey,acOp)
+	return a.broadcastTrx(acOp)
 }
 
 func (a *Account) BpRegist(owner, bpUrl, bpDesc, pubKeyStr string, fee, proposedStaminaFree, tpsExpected, bpEpochDuration, ticketPrice, bpPerTicketWeight uint64, bpTopN uint32) (*grpcpb.BroadcastTrxResponse, error) {
@@ -58,7 +83,7 @@ func (a *Account) BpRegist(owner, bpUrl, bpDesc, pubKeyStr string, fee, proposed
 			PerTicketWeight:    bpPerTicketWeight,
 		},
 	}
-	return a.broadcastTrx(a.PrivateKey,bpRegistOp)
+	return a.broadcastTrx(bpRegistOp)
 }
 
 func (a *Account) BpEnable(name string, cancel bool) (*grpcpb.BroadcastTrxResponse, error) {
@@ -66,7 +91,7 @@ func (a *Account) BpEnable(name string, cancel bool) (*grpcpb.BroadcastTrxRespon
 		Owner:      &prototype.AccountName{Value: name},
 		Cancel:     cancel,
 	}
-	return a.broadcastTrx(a.PrivateKey,bpEnableOp)
+	return a.broadcastTrx(bpEnableOp)
 }
 
 func (a *Account) BpVote(bp string, cancel bool) (*grpcpb.BroadcastTrxResponse, error) {
@@ -75,7 +100,7 @@ func (a *Account) BpVote(bp string, cancel bool) (*grpcpb.BroadcastTrxResponse,
 		BlockProducer: &prototype.AccountName{Value: bp},
 		Cancel:  cancel,
 	}
-	return a.broadcastTrx(a.PrivateKey,bpVoteOp)
+	return a.broadcastTrx(bpVoteOp)
 }
 
 func (a *Account) Post(title,content string,tags []string, postBeneficiaryRoute map[string]int) (*grpcpb.BroadcastTrxResponse, error) {
@@ -112,7 +137,7 @@ func (a *Account) Post(title,content string,tags []string, postBeneficiaryRoute
 		Tags:          tags,
 		Beneficiaries: beneficiaries,
 	}
-	return a.broadcastTrx(a.PrivateKey,postOp)
+	return a.broadcastTrx(postOp)
 }
 
 func (a *Account) Reply(content string, postId uint64, replyBeneficiaryRoute map[string]int) (*grpcpb.BroadcastTrxResponse, error) {
@@ -146,7 +171,7 @@ func (a *Account) Reply(content string, postId uint64, replyBeneficiaryRoute map
 		ParentUuid:    postId,
 		Beneficiaries: beneficiaries,
 	}
-	return a.broadcastTrx(a.PrivateKey,replyOp)
+	return a.broadcastTrx(replyOp)
 }
 
 func (a *Account) Follow(following string, cancel bool) (*grpcpb.BroadcastTrxResponse, error) {
@@ -155,7 +180,7 @@ func (a *Account) Follow(following string, cancel bool) (*grpcpb.BroadcastTrxRes
 		FAccount: &prototype.AccountName{Value: following},
 		Cancel:   cancel,
 	}
-	return a.broadcastTrx(a.PrivateKey,followOp)
+	return a.broadcastTrx(followOp)
 }
 
 func (a *Account) Vote(idx uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -163,7 +188,7 @@ func (a *Account) Vote(idx uint64) (*grpcpb.BroadcastTrxResponse, error) {
 		Voter: &prototype.AccountName{Value: a.Name},
 		Idx:   idx,
 	}
-	return a.broadcastTrx(a.PrivateKey,voterOp)
+	return a.broadcastTrx(voterOp)
 }
 
 func (a *Account) Transfer(to string,amount uint64, memo string) (*grpcpb.BroadcastTrxResponse, error) {
@@ -173,7 +198,7 @@ func (a *Account) Transfer(to string,amount uint64, memo string) (*grpcpb.Broadc
 		Amount: prototype.NewCoin(amount),
 		Memo:   memo,
 	}
-	return a.broadcastTrx(a.PrivateKey,transferOp)
+	return a.broadcastTrx(transferOp)
 }
 
 func (a *Account) ContractDeploy(cname string, abi,code []byte, upgradeable bool, contractUrl,contractDesc string ) (*grpcpb.BroadcastTrxResponse, error) {
@@ -197,7 +222,7 @@ func (a *Account) ContractDeploy(cname string, abi,code []byte, upgradeable bool
 		Url: contractUrl,
 		Describe: contractDesc,
 	}
-	return a.broadcastTrx(a.PrivateKey,contractDeployOp)
+	return a.broadcastTrx(contractDeployOp)
 }
 
 func (a *Account) ContractApply(owner,cname,params,method string,fee uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -209,7 +234,7 @@ func (a *Account) ContractApply(owner,cname,params,method string,fee uint64) (*g
 		Params:   params,
 		Method:	  method,
 	}
-	return a.broadcastTrx(a.PrivateKey,contractApplyOp)
+	return a.broadcastTrx(contractApplyOp)
 }
 
 func (a *Account) ConvertVest(amount uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -217,7 +242,7 @@ func (a *Account) ConvertVest(amount uint64) (*grpcpb.BroadcastTrxResponse, erro
 		From:   &prototype.AccountName{Value: a.Name},
 		Amount: prototype.NewVest(uint64(amount)),
 	}
-	return a.broadcastTrx(a.PrivateKey,convertVestOp)
+	return a.broadcastTrx(convertVestOp)
 }
 
 func (a *Account) Stake(to string, amount uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -226,7 +251,7 @@ func (a *Account) Stake(to string, amount uint64) (*grpcpb.BroadcastTrxResponse,
 		To:   &prototype.AccountName{Value: to},
 		Amount:    prototype.NewCoin(amount),
 	}
-	return a.broadcastTrx(a.PrivateKey,stakeOp)
+	return a.broadcastTrx(stakeOp)
 }
 
 func (a *Account) UnStake(debtor string, amount uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -235,7 +260,7 @@ func (a *Account) UnStake(debtor string, amount uint64) (*grpcpb.BroadcastTrxRes
 		Debtor:   &prototype.AccountName{Value: debtor},
 		Amount:    prototype.NewCoin(amount),
 	}
-	return a.broadcastTrx(a.PrivateKey,unStakeOp)
+	return a.broadcastTrx(unStakeOp)
 }
 
 func (a *Account) BpUpdate(name string,bpUpdateStaminaFree,bpUpdateTpsExpected,bpUpdateEpochDuration,bpUpdatePerTicketWeight,bpUpdateCreateAccountFee,bpUpdatePerTicketPrice uint64,bpUpdateTopN uint32) (*grpcpb.BroadcastTrxResponse, error) {
@@ -252,7 +277,7 @@ func (a *Account) BpUpdate(name string,bpUpdateStaminaFree,bpUpdateTpsExpected,b
 		Owner:                 &prototype.AccountName{Value: name},
 		Props:                 props,
 	}
-	return a.broadcastTrx(a.PrivateKey,bpUpdateOp)
+	return a.broadcastTrx(bpUpdateOp)
 }
 
 func (a *Account) AccountUpdate(pubKeyStr string) (*grpcpb.BroadcastTrxResponse, error) {
@@ -265,7 +290,7 @@ func (a *Account) AccountUpdate(pubKeyStr string) (*grpcpb.BroadcastTrxResponse,
 		Owner:         &prototype.AccountName{Value: a.Name},
 		PubKey:        pubKey,
 	}
-	return a.broadcastTrx(a.PrivateKey,accountUpdateOp)
+	return a.broadcastTrx(accountUpdateOp)
 }
 
 func (a *Account) AcquireTicket(name string, count uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -273,7 +298,7 @@ func (a *Account) AcquireTicket(name string, count uint64) (*grpcpb.BroadcastTrx
 		Account: &prototype.AccountName{Value:name},
 		Count: count,
 	}
-	return a.broadcastTrx(a.PrivateKey,acquireTicketOp)
+	return a.broadcastTrx(acquireTicketOp)
 }
 
 func (a *Account) VoteByTicket(name string,postId,count uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -282,7 +307,7 @@ func (a *Account) VoteByTicket(name string,postId,count uint64) (*grpcpb.Broadca
 		Idx: postId,
 		Count: count,
 	}
-	return a.broadcastTrx(a.PrivateKey,voteByTicketOp)
+	return a.broadcastTrx(voteByTicketOp)
 }
 
 
@@ -293,7 +318,7 @@ func (a *Account) TransferToVest(to string, amount uint64, memo string) (*grpcpb
 		Amount:prototype.NewCoin(amount),
 		Memo:memo,
 	}
-	return a.broadcastTrx(a.PrivateKey,transferToVestOp)
+	return a.broadcastTrx(transferToVestOp)
 }
 
 func (a *Account) DelegateVest(to string, amount uint64, expiration uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -303,7 +328,7 @@ func (a *Account) DelegateVest(to string, amount uint64, expiration uint64) (*gr
 		Amount:prototype.NewVest(amount),
 		Expiration:expiration,
 	}
-	return a.broadcastTrx(a.PrivateKey,delegateVestOp)
+	return a.broadcastTrx(delegateVestOp)
 }
 
 func (a *Account) UnDelegateVest(orderId uint64) (*grpcpb.BroadcastTrxResponse, error) {
@@ -311,15 +336,81 @@ func (a *Account) UnDelegateVest(orderId uint64) (*grpcpb.BroadcastTrxResponse,
 		Account:prototype.NewAccountName(a.Name),
 		OrderId:orderId,
 	}
-	return a.broadcastTrx(a.PrivateKey,unDelegateVestOp)
+	return a.broadcastTrx(unDelegateVestOp)
 }
 
-func (a *Account) broadcastTrx(privateKey string, op ...interface{}) (*grpcpb.BroadcastTrxResponse,error) {
+// sign an off-chain message, e.g. to prove ownership of the account to a dapp
+func (a *Account) SignMessage(message []byte) (string, error) {
+	privateKey, err := a.getPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return utils.SignMessage(privateKey, a.GetChainIdCallBack(), message)
+}
+
+// return private key used for signing
+func (a *Account) getPrivateKey() (string, error) {
+	if a.getPrivateKeyCallBack != nil {
+		return a.getPrivateKeyCallBack()
+	}
+	return a.PrivateKey, nil
+}
+
+func (a *Account) broadcastTrx(op ...interface{}) (*grpcpb.BroadcastTrxResponse,error) {
+	privateKey, err := a.getPrivateKey()
+	if err != nil {
+		return nil,err
+	}
+	// refused operations are never signed
+	done, err := a.checkOperations(op)
+	if err != nil {
+		return nil,err
+	}
+	applied := false
+	defer func() { done(applied) }()
+
 	signTx, err := utils.GenerateSignedTxAndValidate(rpcclient.GetRpc(), privateKey, string(a.GetChainIdCallBack()),op...)
 	if err != nil {
 		return nil,err
 	}
+	switch a.Mode {
+	case ModeDryRun:
+		return a.dryRun(signTx)
+	case ModeCheckStamina:
+		if err := a.checkStamina(signTx); err != nil {
+			return nil,err
+		}
+	}
 	req := &grpcpb.BroadcastTrxRequest{Transaction: signTx}
 	res, err := rpcclient.GetRpc().BroadcastTrx(context.Background(),req)
+	applied = mayBeApplied(res, err)
 	return res,err
 }
+
+// consult checkOperationsCallBack, the returned function is never nil
+func (a *Account) checkOperations(ops []interface{}) (func(applied bool), error) {
+	var done func(applied bool)
+	if a.checkOperationsCallBack != nil {
+		var err error
+		if done, err = a.checkOperationsCallBack(ops); err != nil {
+			return nil, err
+		}
+	}
+	if done == nil {
+		done = func(bool) {}
+	}
+	return done, nil
+}
+
+// return false if the transaction is known not to be applied, e.g. it's rejected by the node
+// after a network error it's unknown, the transaction may have been delivered
+func mayBeApplied(res *grpcpb.BroadcastTrxResponse, err error) bool {
+	if err != nil {
+		return true
+	}
+	receipt, err := utils.NewReceipt(res)
+	if _, rejected := err.(*utils.TrxError); rejected {
+		return false
+	}
+	return receipt == nil || receipt.Succeeded()
+}
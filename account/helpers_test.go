@@ -0,0 +1,91 @@
+package account
+
+import (
+	"context"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/rpcclient"
+	"github.com/coschain/cos-sdk-go/utils"
+	"google.golang.org/grpc"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// key of accounts in tests
+const (
+	testKey    = "3sYZkeNuv3nD1karW9CJb57LxRzAEv5sXHMM28UecrMF5Jruep"
+	testPubKey = "COS7DdKA93USv1zhnoxVMukiE6WfaRbZChpLfAwPkPneTtwN2eW1T"
+)
+
+// fakeNode estimates every transaction to use need stamina, and every account to have have stamina
+type fakeNode struct {
+	grpcpb.UnimplementedApiServiceServer
+
+	need, have uint64
+	mu         sync.Mutex
+	trxs       []*prototype.SignedTransaction
+}
+
+// start a grpc server of f, and connect rpcclient to it
+func startNode(t *testing.T, f *fakeNode) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	grpcpb.RegisterApiServiceServer(s, f)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	if err := rpcclient.ConnectRpc(l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// an account signing with testKey on the dev chain
+func newTestAccount(name string) *Account {
+	return NewAccount(name, testKey, func() utils.ChainId { return utils.Dev })
+}
+
+func (f *fakeNode) trxCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.trxs)
+}
+
+func (f *fakeNode) GetAccountByName(ctx context.Context, req *grpcpb.GetAccountByNameRequest) (*grpcpb.AccountResponse, error) {
+	pubKey, err := prototype.PublicKeyFromWIF(testPubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcpb.AccountResponse{Info: &grpcpb.AccountInfo{
+		AccountName:        req.AccountName,
+		PublicKey:          pubKey,
+		StaminaFreeRemain:  f.have / 2,
+		StaminaStakeRemain: f.have - f.have/2,
+	}}, nil
+}
+
+func (f *fakeNode) GetChainState(ctx context.Context, req *grpcpb.NonParamsRequest) (*grpcpb.GetChainStateResponse, error) {
+	return &grpcpb.GetChainStateResponse{State: &grpcpb.ChainState{Dgpo: &prototype.DynamicProperties{
+		HeadBlockId:     &prototype.Sha256{Hash: make([]byte, 32)},
+		HeadBlockNumber: 1,
+		Time:            &prototype.TimePointSec{UtcSeconds: uint32(time.Now().Unix())},
+	}}}, nil
+}
+
+func (f *fakeNode) EstimateStamina(ctx context.Context, req *grpcpb.EsimateRequest) (*grpcpb.EsimateResponse, error) {
+	return &grpcpb.EsimateResponse{Invoice: &prototype.TransactionReceiptWithInfo{
+		Status:   prototype.StatusSuccess,
+		NetUsage: f.need / 2,
+		CpuUsage: f.need - f.need/2,
+	}}, nil
+}
+
+func (f *fakeNode) BroadcastTrx(ctx context.Context, req *grpcpb.BroadcastTrxRequest) (*grpcpb.BroadcastTrxResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trxs = append(f.trxs, req.Transaction)
+	return &grpcpb.BroadcastTrxResponse{Invoice: &prototype.TransactionReceiptWithInfo{Status: prototype.StatusSuccess}}, nil
+}
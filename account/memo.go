@@ -0,0 +1,46 @@
+package account
+
+import (
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/utils"
+)
+
+// encrypt a memo for recipient, using recipient's on-chain public key
+func (a *Account) EncryptMemo(to, memo string) (string, error) {
+	privateKey, err := a.getPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	info, err := getAccountInfo(to)
+	if err != nil {
+		return "", err
+	}
+	return utils.EncryptMemo(privateKey, info.PublicKey.ToWIF(), memo)
+}
+
+// decrypt a memo sent to or from this account
+func (a *Account) DecryptMemo(memo string) (string, error) {
+	privateKey, err := a.getPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return utils.DecryptMemo(privateKey, memo)
+}
+
+// same as Transfer, but memo is encrypted so only sender and recipient can read it
+func (a *Account) TransferWithEncryptedMemo(to string, amount uint64, memo string) (*grpcpb.BroadcastTrxResponse, error) {
+	encrypted, err := a.EncryptMemo(to, memo)
+	if err != nil {
+		return nil, err
+	}
+	return a.Transfer(to, amount, encrypted)
+}
+
+// same as TransferToVest, but memo is encrypted so only sender and recipient can read it
+func (a *Account) TransferToVestWithEncryptedMemo(to string, amount uint64, memo string) (*grpcpb.BroadcastTrxResponse, error) {
+	encrypted, err := a.EncryptMemo(to, memo)
+	if err != nil {
+		return nil, err
+	}
+	return a.TransferToVest(to, amount, encrypted)
+}
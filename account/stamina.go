@@ -0,0 +1,130 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/rpcclient"
+	"github.com/kataras/go-errors"
+)
+
+// Mode decides what an account operation does after the transaction is signed
+type Mode int
+
+const (
+	// sign and broadcast the transaction
+	ModeBroadcast Mode = iota
+	// sign and estimate stamina, never broadcast, see DryRun for stamina of the account
+	ModeDryRun
+	// estimate stamina first, broadcast only when the account has enough stamina
+	ModeCheckStamina
+)
+
+// StaminaError is returned by ModeCheckStamina when an account can't afford a transaction
+type StaminaError struct {
+	Name string
+	Need uint64
+	Have uint64
+}
+
+func (e *StaminaError) Error() string {
+	return fmt.Sprintf("stamina not enough, account: %s, have: %d, need: %d", e.Name, e.Have, e.Need)
+}
+
+// return a copy of account, whose operations run in the given mode
+// e.g. wallet.Account(name).WithMode(account.ModeDryRun).Transfer(to, amount, memo)
+func (a *Account) WithMode(mode Mode) *Account {
+	acc := *a
+	acc.Mode = mode
+	return &acc
+}
+
+// return stamina the account can use currently
+func (a *Account) AvailableStamina() (uint64, error) {
+	info, err := getAccountInfo(a.Name)
+	if err != nil {
+		return 0, err
+	}
+	return info.StaminaFreeRemain + info.StaminaStakeRemain, nil
+}
+
+// query on-chain information of an account
+func getAccountInfo(name string) (*grpcpb.AccountInfo, error) {
+	req := &grpcpb.GetAccountByNameRequest{AccountName: prototype.NewAccountName(name)}
+	res, err := rpcclient.GetRpc().GetAccountByName(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		return nil, errors.New(fmt.Sprintf("account %s not found", name))
+	}
+	return res.Info, nil
+}
+
+// Estimate is the stamina estimation of a transaction signed in ModeDryRun
+type Estimate struct {
+	Invoice *prototype.TransactionReceiptWithInfo // estimation by node
+	Need    uint64                                // stamina the transaction uses, net and cpu
+	Have    uint64                                // stamina the account can use currently
+	Enough  bool
+}
+
+// run f with a copy of account in ModeDryRun, return estimation of the last transaction signed by f
+// nothing is broadcast, e.g. acc.DryRun(func(a *Account) error { _, err := a.Transfer(to, amount, memo); return err })
+func (a *Account) DryRun(f func(a *Account) error) (*Estimate, error) {
+	acc := a.WithMode(ModeDryRun)
+	var estimate *Estimate
+	acc.estimated = func(e *Estimate) {
+		estimate = e
+	}
+	if err := f(acc); err != nil {
+		return nil, err
+	}
+	if estimate == nil {
+		return nil, errors.New("no transaction is signed")
+	}
+	return estimate, nil
+}
+
+// estimate stamina of a signed transaction, and compare it with stamina of the account
+func (a *Account) estimate(signTx *prototype.SignedTransaction) (*Estimate, error) {
+	req := &grpcpb.EsimateRequest{Transaction: signTx}
+	res, err := rpcclient.GetRpc().EstimateStamina(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Invoice == nil {
+		return nil, errors.New("empty estimation")
+	}
+	have, err := a.AvailableStamina()
+	if err != nil {
+		return nil, err
+	}
+	need := res.Invoice.NetUsage + res.Invoice.CpuUsage
+	return &Estimate{Invoice: res.Invoice, Need: need, Have: have, Enough: need <= have}, nil
+}
+
+// estimate a signed transaction, the estimation is put into the Invoice of a broadcast response
+func (a *Account) dryRun(signTx *prototype.SignedTransaction) (*grpcpb.BroadcastTrxResponse, error) {
+	estimate, err := a.estimate(signTx)
+	if err != nil {
+		return nil, err
+	}
+	if a.estimated != nil {
+		a.estimated(estimate)
+	}
+	return &grpcpb.BroadcastTrxResponse{Invoice: estimate.Invoice, Status: estimate.Invoice.Status, Msg: estimate.Invoice.ErrorInfo}, nil
+}
+
+// estimate a signed transaction and make sure the account can afford it
+func (a *Account) checkStamina(signTx *prototype.SignedTransaction) error {
+	estimate, err := a.estimate(signTx)
+	if err != nil {
+		return err
+	}
+	if !estimate.Enough {
+		return &StaminaError{Name: a.Name, Need: estimate.Need, Have: estimate.Have}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package account
+
+import (
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	for _, have := range []uint64{150, 50} {
+		node := &fakeNode{need: 100, have: have}
+		startNode(t, node)
+		acc := newTestAccount("alice1")
+
+		estimate, err := acc.DryRun(func(a *Account) error {
+			_, err := a.Transfer("bobby1", 1, "")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estimate.Need != 100 || estimate.Have != have || estimate.Enough != (have >= 100) || estimate.Invoice == nil {
+			t.Fatalf("have %d: got estimate %+v", have, estimate)
+		}
+		// the mode of the account isn't changed
+		if acc.Mode != ModeBroadcast {
+			t.Fatalf("account mode changed to %d", acc.Mode)
+		}
+		res, err := acc.WithMode(ModeDryRun).Transfer("bobby1", 1, "")
+		if err != nil || res.Invoice.NetUsage+res.Invoice.CpuUsage != 100 {
+			t.Fatalf("got response %+v, error %v", res, err)
+		}
+		if n := node.trxCount(); n != 0 {
+			t.Fatalf("%d transactions broadcast in dry run", n)
+		}
+	}
+}
+
+func TestDryRunWithoutTransaction(t *testing.T) {
+	startNode(t, &fakeNode{})
+	if _, err := newTestAccount("alice1").DryRun(func(a *Account) error { return nil }); err == nil {
+		t.Fatal("dry run without a transaction succeeded")
+	}
+}
+
+func TestCheckStamina(t *testing.T) {
+	node := &fakeNode{need: 100, have: 50}
+	startNode(t, node)
+	acc := newTestAccount("alice1").WithMode(ModeCheckStamina)
+
+	_, err := acc.Transfer("bobby1", 1, "")
+	if serr, ok := err.(*StaminaError); !ok || serr.Need != 100 || serr.Have != 50 || serr.Name != "alice1" {
+		t.Fatalf("got error %v", err)
+	}
+	if n := node.trxCount(); n != 0 {
+		t.Fatalf("%d transactions broadcast without enough stamina", n)
+	}
+
+	node = &fakeNode{need: 100, have: 100}
+	startNode(t, node)
+	if _, err := acc.Transfer("bobby1", 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := node.trxCount(); n != 1 {
+		t.Fatalf("%d transactions broadcast, want 1", n)
+	}
+}
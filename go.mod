@@ -4,7 +4,9 @@ require (
 	github.com/coschain/contentos-go v1.0.8
 	github.com/ethereum/go-ethereum v1.9.2
 	github.com/kataras/go-errors v0.0.3
+	github.com/syndtr/goleveldb v0.0.0-20181012014443-6b91fda63f2e
 	github.com/tyler-smith/go-bip32 v0.0.0-20170922074101-2c9cfd177564
 	github.com/tyler-smith/go-bip39 v1.0.2
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 	google.golang.org/grpc v1.25.1
 )
@@ -3,12 +3,17 @@ package rpcclient
 import (
 	"github.com/coschain/contentos-go/rpc/pb"
 	"google.golang.org/grpc"
+	"sync"
 )
 
 var rpcClient grpcpb.ApiServiceClient
 var oldConn *grpc.ClientConn
+// guards rpcClient and oldConn, wallets can be created while others are querying
+var rpcMu sync.RWMutex
 
 func GetRpc() grpcpb.ApiServiceClient {
+	rpcMu.RLock()
+	defer rpcMu.RUnlock()
 	if rpcClient == nil {
 		panic("call ConnectRpc first")
 	}
@@ -16,6 +21,8 @@ func GetRpc() grpcpb.ApiServiceClient {
 }
 
 func ConnectRpc(ip string) error {
+	rpcMu.Lock()
+	defer rpcMu.Unlock()
 	if oldConn != nil {
 		oldConn.Close()
 	}
@@ -28,4 +35,4 @@ func ConnectRpc(ip string) error {
 	oldConn = conn
 
 	return nil
-}
\ No newline at end of file
+}
@@ -5,7 +5,11 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
 	"io"
+	"math/bits"
 )
 
 const (
@@ -45,4 +49,128 @@ func DecryptData(cipherdata, passphrase, iv []byte) ([]byte, error) {
 	stream := cipher.NewCTR(block, iv)
 	stream.XORKeyStream(data, cipherdata)
 	return data, nil
-}
\ No newline at end of file
+}
+
+// KdfParams are scrypt parameters used to derive a key from password
+// N is the cpu/memory cost, must be a power of 2 greater than 1
+type KdfParams struct {
+	N int
+	R int
+	P int
+}
+
+var (
+	// about 256MB memory and one second cpu on a common machine
+	DefaultKdfParams = KdfParams{N: 1 << 18, R: 8, P: 1}
+	// for mobile devices or tests
+	LightKdfParams = KdfParams{N: 1 << 12, R: 8, P: 6}
+)
+
+const (
+	SaltLength     int    = 32
+	KdfScrypt      string = "scrypt"
+	derivedKeySize int    = PasswordLength * 2
+	// gcm nonce size used by SealData
+	NonceLength int = 12
+
+	// parameters may come from files or keys made by others, these bound what a crafted one can cost
+	// scrypt takes 128 * N * R bytes memory
+	MaxKdfMemory int64 = 1 << 30
+	// cpu cost N * R * P, 8 times of DefaultKdfParams
+	MaxKdfCost int64 = 1 << 24
+)
+
+// check params can be used by DeriveKey, they're within MaxKdfMemory and MaxKdfCost
+func (params KdfParams) Validate() error {
+	if params.N <= 1 || bits.OnesCount(uint(params.N)) != 1 || params.R < 1 || params.P < 1 ||
+		int64(params.N) > MaxKdfCost || int64(params.R) > MaxKdfCost || int64(params.P) > MaxKdfCost ||
+		128*int64(params.N)*int64(params.R) > MaxKdfMemory ||
+		int64(params.N)*int64(params.R)*int64(params.P) > MaxKdfCost {
+		return errors.New(fmt.Sprintf("invalid or too expensive kdf parameters: %+v", params))
+	}
+	return nil
+}
+
+// generate a random salt for key derivation
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// generate a random aes-256 key
+func NewKey() ([]byte, error) {
+	key := make([]byte, PasswordLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// derive an encryption key and a mac key from password with scrypt
+// return an error if params are not valid, see KdfParams.Validate
+func DeriveKey(passphrase, salt []byte, params KdfParams) ([]byte, []byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, nil, err
+	}
+	dk, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, derivedKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk[:PasswordLength], dk[PasswordLength:], nil
+}
+
+// same as DecryptData, but use a derived key directly, it reads keystores of version 1
+func DecryptDataWithKey(cipherdata, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return []byte{}, err
+	}
+	data := make([]byte, len(cipherdata))
+	stream := cipher.NewCTR(block, iv)
+	stream.XORKeyStream(data, cipherdata)
+	return data, nil
+}
+
+// encrypt and authenticate data with aes-gcm, additionalData is authenticated but not encrypted
+func SealData(data, key, additionalData []byte) ([]byte, []byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return []byte{}, []byte{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return []byte{}, []byte{}, err
+	}
+	return aead.Seal(nil, nonce, data, additionalData), nonce, nil
+}
+
+// decrypt data sealed by SealData, fail if data or additionalData is modified
+func OpenData(cipherdata, key, nonce, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return []byte{}, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return []byte{}, errors.New("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, cipherdata, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// overwrite a buffer holding secrets with zeros
+// it's best effort, copies made by runtime or by string conversions can't be cleared
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
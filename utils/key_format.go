@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"strings"
+)
+
+const (
+	privateKeyLength = 32
+
+	pemTypeEC    = "EC PRIVATE KEY"
+	pemTypePKCS8 = "PRIVATE KEY"
+
+	ethKeyStoreVersion = 3
+	ethCipher          = "aes-128-ctr"
+	ethKdfScrypt       = "scrypt"
+	ethKdfPBKDF2       = "pbkdf2"
+	ethKeyLength       = 32
+	// geth uses 262144, a crafted file can't make pbkdf2 run much longer
+	ethMaxPBKDF2Iterations = 1 << 24
+)
+
+var (
+	ErrInvalidKeyFormat = errors.New("invalid private key format")
+	ErrUnsupportedCurve = errors.New("private key is not on secp256k1 curve")
+	ErrWrongPassword    = errors.New("password incorrect")
+
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// return a private key of raw bytes, which must be a valid secp256k1 scalar
+func privateKeyFromRaw(raw []byte) (*prototype.PrivateKeyType, error) {
+	if len(raw) > privateKeyLength {
+		return nil, ErrInvalidKeyFormat
+	}
+	// encoders may strip leading zeros
+	d := make([]byte, privateKeyLength)
+	copy(d[privateKeyLength-len(raw):], raw)
+	if _, err := crypto.ToECDSA(d); err != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	return prototype.PrivateKeyFromBytes(d), nil
+}
+
+// parse a raw private key in hex, with or without 0x prefix, e.g. an ethereum private key
+func PrivateKeyFromHex(s string) (*prototype.PrivateKeyType, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != privateKeyLength {
+		return nil, ErrInvalidKeyFormat
+	}
+	return privateKeyFromRaw(raw)
+}
+
+// return the raw private key in hex without 0x prefix
+func PrivateKeyToHex(key *prototype.PrivateKeyType) string {
+	return hex.EncodeToString(key.Data)
+}
+
+// SEC 1 ECPrivateKey
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// PKCS #8 PrivateKeyInfo
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// parse a secp256k1 private key in DER, either SEC 1 (openssl ec) or unencrypted PKCS #8 (openssl pkcs8 -nocrypt)
+func PrivateKeyFromDER(der []byte) (*prototype.PrivateKeyType, error) {
+	var p8 pkcs8PrivateKey
+	if rest, err := asn1.Unmarshal(der, &p8); err == nil && len(rest) == 0 && p8.Algo.Algorithm != nil {
+		if !p8.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+			return nil, ErrInvalidKeyFormat
+		}
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(p8.Algo.Parameters.FullBytes, &curve); err != nil {
+			return nil, ErrInvalidKeyFormat
+		}
+		if !curve.Equal(oidNamedCurveSecp256k1) {
+			return nil, ErrUnsupportedCurve
+		}
+		der = p8.PrivateKey
+	}
+
+	var key ecPrivateKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 || key.Version != 1 {
+		return nil, ErrInvalidKeyFormat
+	}
+	if key.NamedCurveOID != nil && !key.NamedCurveOID.Equal(oidNamedCurveSecp256k1) {
+		return nil, ErrUnsupportedCurve
+	}
+	return privateKeyFromRaw(key.PrivateKey)
+}
+
+// encode a private key in SEC 1 DER, with curve and public key, same as openssl ec
+func PrivateKeyToDER(key *prototype.PrivateKeyType) ([]byte, error) {
+	ecdsaKey, err := key.ToECDSA()
+	if err != nil {
+		return nil, err
+	}
+	pub := crypto.FromECDSAPub(&ecdsaKey.PublicKey)
+	return asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    key.Data,
+		NamedCurveOID: oidNamedCurveSecp256k1,
+		PublicKey:     asn1.BitString{Bytes: pub, BitLength: len(pub) * 8},
+	})
+}
+
+// parse the first "EC PRIVATE KEY" or "PRIVATE KEY" block in PEM, encrypted PEM is not supported
+func PrivateKeyFromPEM(data []byte) (*prototype.PrivateKeyType, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, ErrInvalidKeyFormat
+		}
+		// e.g. "EC PARAMETERS" before the key, by openssl ecparam -genkey
+		if block.Type != pemTypeEC && block.Type != pemTypePKCS8 {
+			continue
+		}
+		if _, ok := block.Headers["DEK-Info"]; ok {
+			return nil, errors.New("encrypted pem is not supported, decrypt it with openssl first")
+		}
+		return PrivateKeyFromDER(block.Bytes)
+	}
+}
+
+// encode a private key in an "EC PRIVATE KEY" PEM block
+func PrivateKeyToPEM(key *prototype.PrivateKeyType) ([]byte, error) {
+	der, err := PrivateKeyToDER(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeEC, Bytes: der}), nil
+}
+
+// ethereum keystore file, version 3
+type ethKeyStore struct {
+	Address string        `json:"address"`
+	Crypto  ethCryptoJSON `json:"crypto"`
+	Id      string        `json:"id"`
+	Version int           `json:"version"`
+}
+
+type ethCryptoJSON struct {
+	Cipher       string          `json:"cipher"`
+	CipherText   string          `json:"ciphertext"`
+	CipherParams ethCipherParams `json:"cipherparams"`
+	Kdf          string          `json:"kdf"`
+	KdfParams    ethKdfParams    `json:"kdfparams"`
+	Mac          string          `json:"mac"`
+}
+
+type ethCipherParams struct {
+	IV string `json:"iv"`
+}
+
+type ethKdfParams struct {
+	DkLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+	// pbkdf2
+	C   int    `json:"c,omitempty"`
+	Prf string `json:"prf,omitempty"`
+}
+
+// decrypt an ethereum keystore v3 json file, e.g. one created by geth or MetaMask
+// return ErrWrongPassword if passphrase is incorrect
+func PrivateKeyFromEthKeyStore(keyJson []byte, passphrase string) (*prototype.PrivateKeyType, error) {
+	var ks ethKeyStore
+	if err := json.Unmarshal(keyJson, &ks); err != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	if ks.Version != ethKeyStoreVersion {
+		return nil, errors.New(fmt.Sprintf("unsupported ethereum keystore version %d", ks.Version))
+	}
+	c := ks.Crypto
+	if c.Cipher != ethCipher {
+		return nil, errors.New("unsupported ethereum keystore cipher: " + c.Cipher)
+	}
+	salt, err := hex.DecodeString(c.KdfParams.Salt)
+	if err != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	iv, err := hex.DecodeString(c.CipherParams.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, ErrInvalidKeyFormat
+	}
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	mac, err := hex.DecodeString(c.Mac)
+	if err != nil {
+		return nil, ErrInvalidKeyFormat
+	}
+	if c.KdfParams.DkLen != ethKeyLength {
+		return nil, ErrInvalidKeyFormat
+	}
+
+	var derivedKey []byte
+	switch c.Kdf {
+	case ethKdfScrypt:
+		params := KdfParams{N: c.KdfParams.N, R: c.KdfParams.R, P: c.KdfParams.P}
+		if err := params.Validate(); err != nil {
+			return nil, err
+		}
+		derivedKey, err = scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, c.KdfParams.DkLen)
+		if err != nil {
+			return nil, ErrInvalidKeyFormat
+		}
+	case ethKdfPBKDF2:
+		if c.KdfParams.Prf != "hmac-sha256" {
+			return nil, errors.New("unsupported ethereum keystore pbkdf2 prf: " + c.KdfParams.Prf)
+		}
+		if c.KdfParams.C <= 0 || c.KdfParams.C > ethMaxPBKDF2Iterations {
+			return nil, errors.New(fmt.Sprintf("invalid or too expensive pbkdf2 iterations: %d", c.KdfParams.C))
+		}
+		derivedKey = pbkdf2.Key([]byte(passphrase), salt, c.KdfParams.C, c.KdfParams.DkLen, sha256.New)
+	default:
+		return nil, errors.New("unsupported ethereum keystore kdf: " + c.Kdf)
+	}
+	defer ZeroBytes(derivedKey)
+
+	if !bytes.Equal(crypto.Keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrWrongPassword
+	}
+	raw, err := aesCTR(derivedKey[:16], iv, cipherText)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(raw)
+	return privateKeyFromRaw(raw)
+}
+
+// encrypt a private key to an ethereum keystore v3 json file with scrypt, which can be imported by geth or MetaMask
+func PrivateKeyToEthKeyStore(key *prototype.PrivateKeyType, passphrase string, params KdfParams) ([]byte, error) {
+	ecdsaKey, err := key.ToECDSA()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	id := make([]byte, 16)
+	for _, b := range [][]byte{salt, iv, id} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, ethKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(derivedKey)
+	cipherText, err := aesCTR(derivedKey[:16], iv, key.Data)
+	if err != nil {
+		return nil, err
+	}
+	// random uuid, version 4
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	ks := &ethKeyStore{
+		Address: hex.EncodeToString(crypto.PubkeyToAddress(ecdsaKey.PublicKey).Bytes()),
+		Crypto: ethCryptoJSON{
+			Cipher:       ethCipher,
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: ethCipherParams{IV: hex.EncodeToString(iv)},
+			Kdf:          ethKdfScrypt,
+			KdfParams: ethKdfParams{
+				DkLen: ethKeyLength,
+				Salt:  hex.EncodeToString(salt),
+				N:     params.N,
+				R:     params.R,
+				P:     params.P,
+			},
+			Mac: hex.EncodeToString(crypto.Keccak256(derivedKey[16:32], cipherText)),
+		},
+		Id:      fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		Version: ethKeyStoreVersion,
+	}
+	return json.Marshal(ks)
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/ethereum/go-ethereum/crypto"
+	"io"
+	"strings"
+)
+
+// EncryptedMemoPrefix marks a memo encrypted by EncryptMemo
+const EncryptedMemoPrefix = "#enc1:"
+
+const (
+	pubKeyLength   = 33
+	memoNonceSize  = 12
+	memoHeaderSize = pubKeyLength*2 + memoNonceSize
+)
+
+var (
+	ErrNotEncryptedMemo = errors.New("memo is not encrypted")
+	ErrMemoNotForKey    = errors.New("memo is not encrypted for this key")
+	ErrMemoCorrupted    = errors.New("memo is corrupted")
+)
+
+// check if a memo is encrypted
+func IsEncryptedMemo(memo string) bool {
+	return strings.HasPrefix(memo, EncryptedMemoPrefix)
+}
+
+// encrypt a memo with sender's WIF private key and recipient's WIF public key
+// both sender and recipient can decrypt it with their own private key
+// format: prefix | base64(sender pubkey | recipient pubkey | nonce | aes-gcm ciphertext)
+func EncryptMemo(privateKey, recipientPubKey, memo string) (string, error) {
+	privKey, err := prototype.PrivateKeyFromWIF(privateKey)
+	if err != nil {
+		return "", err
+	}
+	senderPub, err := privKey.PubKey()
+	if err != nil {
+		return "", err
+	}
+	recipientPub, err := prototype.PublicKeyFromWIF(recipientPubKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := memoCipher(privKey, recipientPub)
+	if err != nil {
+		return "", err
+	}
+	header := make([]byte, 0, memoHeaderSize)
+	header = append(header, senderPub.Data...)
+	header = append(header, recipientPub.Data...)
+	nonce := make([]byte, memoNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	header = append(header, nonce...)
+	// public keys are authenticated too, so no one can swap them
+	data := aead.Seal(header, nonce, []byte(memo), header[:pubKeyLength*2])
+	return EncryptedMemoPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decrypt a memo with sender's or recipient's WIF private key
+func DecryptMemo(privateKey, memo string) (string, error) {
+	if !IsEncryptedMemo(memo) {
+		return "", ErrNotEncryptedMemo
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(memo, EncryptedMemoPrefix))
+	if err != nil || len(data) < memoHeaderSize {
+		return "", ErrMemoCorrupted
+	}
+	privKey, err := prototype.PrivateKeyFromWIF(privateKey)
+	if err != nil {
+		return "", err
+	}
+	myPub, err := privKey.PubKey()
+	if err != nil {
+		return "", err
+	}
+	senderPub := data[:pubKeyLength]
+	recipientPub := data[pubKeyLength : pubKeyLength*2]
+	nonce := data[pubKeyLength*2 : memoHeaderSize]
+
+	// the other side of key exchange
+	var peer []byte
+	switch {
+	case bytes.Equal(myPub.Data, recipientPub):
+		peer = senderPub
+	case bytes.Equal(myPub.Data, senderPub):
+		peer = recipientPub
+	default:
+		return "", ErrMemoNotForKey
+	}
+	aead, err := memoCipher(privKey, prototype.PublicKeyFromBytes(peer))
+	if err != nil {
+		return "", ErrMemoCorrupted
+	}
+	plain, err := aead.Open(nil, nonce, data[memoHeaderSize:], data[:pubKeyLength*2])
+	if err != nil {
+		return "", ErrMemoCorrupted
+	}
+	return string(plain), nil
+}
+
+// derive an aes-gcm cipher from ECDH shared secret of a private key and a public key
+func memoCipher(privKey *prototype.PrivateKeyType, pubKey *prototype.PublicKeyType) (cipher.AEAD, error) {
+	ecPriv, err := privKey.ToECDSA()
+	if err != nil {
+		return nil, err
+	}
+	ecPub, err := crypto.DecompressPubkey(pubKey.Data)
+	if err != nil {
+		return nil, err
+	}
+	x, _ := crypto.S256().ScalarMult(ecPub.X, ecPub.Y, ecPriv.D.Bytes())
+	shared := make([]byte, 32)
+	xb := x.Bytes()
+	copy(shared[32-len(xb):], xb)
+	key := sha256.Sum256(append([]byte(EncryptedMemoPrefix), shared...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"testing"
+)
+
+const (
+	memoSenderKey       = "3sYZkeNuv3nD1karW9CJb57LxRzAEv5sXHMM28UecrMF5Jruep"
+	memoSenderPubKey    = "COS7DdKA93USv1zhnoxVMukiE6WfaRbZChpLfAwPkPneTtwN2eW1T"
+	memoRecipientKey    = "43GMm2QXbu7GGg721QbfCPuyY1kDUnPjTDmK5TytnU6c85aGkY"
+	memoRecipientPubKey = "COS88YMwYe8h6dHVvQEyYXgycFhjXP7TWHVzkqhSpdEBWGVKGCm73"
+
+	// "hello, contentos" encrypted from sender to recipient, memos written by older versions must stay readable
+	memoVector    = "#enc1:AzLYfFzUsx2BxbAQr0Ki5BOvJT3DqRvT1TxrLEUpHD3nA6r+qQHf7uBwZWmWGy5ozdFOUI7l0Bm5EHw1NSw4mgkIqosqzemsT/FTfDT5kGgqkCferuTlKQvEvw8DWJaIuNZnj17UtyZ14JSWqjs="
+	memoPlainText = "hello, contentos"
+)
+
+func TestDecryptMemoVector(t *testing.T) {
+	for _, key := range []string{memoSenderKey, memoRecipientKey} {
+		memo, err := DecryptMemo(key, memoVector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if memo != memoPlainText {
+			t.Fatalf("got memo %q, want %q", memo, memoPlainText)
+		}
+	}
+}
+
+func TestMemoRoundTrip(t *testing.T) {
+	pairs := [][3]string{
+		{memoSenderKey, memoRecipientPubKey, memoRecipientKey},
+		{memoRecipientKey, memoSenderPubKey, memoSenderKey},
+	}
+	for _, p := range pairs {
+		encrypted, err := EncryptMemo(p[0], p[1], memoPlainText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncryptedMemo(encrypted) {
+			t.Fatalf("memo has no prefix: %s", encrypted)
+		}
+		memo, err := DecryptMemo(p[2], encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if memo != memoPlainText {
+			t.Fatalf("got memo %q, want %q", memo, memoPlainText)
+		}
+	}
+}
+
+func TestDecryptMemoErrors(t *testing.T) {
+	other, err := prototype.GenerateNewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptMemo(other.ToWIF(), memoVector); err != ErrMemoNotForKey {
+		t.Fatalf("other key got %v", err)
+	}
+	if _, err := DecryptMemo(memoRecipientKey, memoPlainText); err != ErrNotEncryptedMemo {
+		t.Fatalf("plain memo got %v", err)
+	}
+	// flip a bit of ciphertext
+	tampered := []byte(memoVector)
+	tampered[len(tampered)-5] ^= 1
+	if _, err := DecryptMemo(memoRecipientKey, string(tampered)); err != ErrMemoCorrupted {
+		t.Fatalf("tampered memo got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/coschain/contentos-go/common"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+)
+
+// MessagePrefix separates off-chain messages from transactions, so a signed message can never be
+// replayed as a transaction signature
+const MessagePrefix = "\x19Contentos Signed Message:\n"
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// return the digest that is actually signed for an off-chain message
+// digest = sha256(prefix | chain id | message length | message)
+func HashMessage(chainId ChainId, message []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(MessagePrefix))
+	h.Write(common.Int2Bytes(common.GetChainIdByName(string(chainId))))
+	h.Write([]byte(fmt.Sprintf("%d", len(message))))
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// sign an off-chain message with a WIF private key, return hex encoded signature
+func SignMessage(privateKey string, chainId ChainId, message []byte) (string, error) {
+	privKey, err := prototype.PrivateKeyFromWIF(privateKey)
+	if err != nil {
+		return "", err
+	}
+	sig, err := secp256k1.Sign(HashMessage(chainId, message), privKey.Data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig), nil
+}
+
+// recover the WIF public key who signed an off-chain message
+func RecoverMessageSigner(chainId ChainId, message []byte, signature string) (string, error) {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	pubKey, err := recoverPubKey(HashMessage(chainId, message), sig)
+	if err != nil {
+		return "", err
+	}
+	return pubKey.ToWIF(), nil
+}
+
+// check if an off-chain message is signed by the WIF public key
+func VerifyMessage(pubKey string, chainId ChainId, message []byte, signature string) bool {
+	signer, err := RecoverMessageSigner(chainId, message, signature)
+	if err != nil {
+		return false
+	}
+	return signer == pubKey
+}
+
+// recover compressed public key from a digest and a 65 bytes recoverable signature
+func recoverPubKey(digest, sig []byte) (*prototype.PublicKeyType, error) {
+	if err := (&prototype.SignatureType{Sig: sig}).Validate(); err != nil {
+		return nil, ErrInvalidSignature
+	}
+	buf, err := secp256k1.RecoverPubkey(digest, sig)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	ecPubKey, err := crypto.UnmarshalPubkey(buf)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return prototype.PublicKeyFromBytes(secp256k1.CompressPubkey(ecPubKey.X, ecPubKey.Y)), nil
+}
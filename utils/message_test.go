@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+const (
+	testKey     = "3sYZkeNuv3nD1karW9CJb57LxRzAEv5sXHMM28UecrMF5Jruep"
+	testPubKey  = "COS7DdKA93USv1zhnoxVMukiE6WfaRbZChpLfAwPkPneTtwN2eW1T"
+	testKey2    = "43GMm2QXbu7GGg721QbfCPuyY1kDUnPjTDmK5TytnU6c85aGkY"
+	testPubKey2 = "COS88YMwYe8h6dHVvQEyYXgycFhjXP7TWHVzkqhSpdEBWGVKGCm73"
+
+	// "hello, contentos" signed by testKey on dev chain, signatures are deterministic (RFC 6979)
+	messageVector     = "hello, contentos"
+	messageHashVector = "40bffea7272e484a1601558e1c711a8fab43a213506c09ac94213cd250ab2049"
+	messageSigVector  = "8dba2dd4b8848050ff44595003d5648dcaa2950b72970c4d63b93c16b6b5509f119cdaf9d3b8c62f7533ea35db64506984212461ac03cd4a20970a6fd060783801"
+)
+
+func TestSignMessageVector(t *testing.T) {
+	if h := hex.EncodeToString(HashMessage(Dev, []byte(messageVector))); h != messageHashVector {
+		t.Fatalf("got digest %s, want %s", h, messageHashVector)
+	}
+	sig, err := SignMessage(testKey, Dev, []byte(messageVector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig != messageSigVector {
+		t.Fatalf("got signature %s, want %s", sig, messageSigVector)
+	}
+	signer, err := RecoverMessageSigner(Dev, []byte(messageVector), messageSigVector)
+	if err != nil || signer != testPubKey {
+		t.Fatalf("recovered signer %s, error %v", signer, err)
+	}
+	if !VerifyMessage(testPubKey, Dev, []byte(messageVector), messageSigVector) {
+		t.Fatal("signature is not verified")
+	}
+}
+
+func TestVerifyMessageRejects(t *testing.T) {
+	message := []byte(messageVector)
+	if VerifyMessage(testPubKey2, Dev, message, messageSigVector) {
+		t.Fatal("verified with another key")
+	}
+	if VerifyMessage(testPubKey, Main, message, messageSigVector) {
+		t.Fatal("verified on another chain")
+	}
+	if VerifyMessage(testPubKey, Dev, []byte("hello, contentos!"), messageSigVector) {
+		t.Fatal("verified another message")
+	}
+
+	sig, _ := hex.DecodeString(messageSigVector)
+	sig[10] ^= 1
+	if VerifyMessage(testPubKey, Dev, message, hex.EncodeToString(sig)) {
+		t.Fatal("verified a changed signature")
+	}
+	for _, bad := range []string{"", "zz", messageSigVector[:64], messageSigVector + "00"} {
+		if _, err := RecoverMessageSigner(Dev, message, bad); err != ErrInvalidSignature {
+			t.Fatalf("signature %q got %v", bad, err)
+		}
+	}
+	if _, err := SignMessage("bad key", Dev, message); err == nil {
+		t.Fatal("signed with an invalid key")
+	}
+}
@@ -16,6 +16,9 @@ type DerivationPath []uint32
 var DefaultRootDerivationPath = DerivationPath{0x80000000 + 44, 0x80000000 + 3077, 0x80000000 + 0, 0, 0}
 const hdPath string = "m/44'/3077'/0'/0/0"
 
+// derivation path used by GenerateKeyPairFromMnemonic
+const DefaultHDPath = hdPath
+
 func GenerateNewMnemonic() (string, error) {
 	entropy, err := bip39.NewEntropy(256)
 	if err != nil {
@@ -30,6 +33,21 @@ func GenerateNewMnemonic() (string, error) {
 
 
 func GenerateKeyPairFromMnemonic(mnemonic string) (string, string, error) {
+	return GenerateKeyPairFromMnemonicWithPath(mnemonic, hdPath)
+}
+
+// check if a mnemonic has valid words and checksum
+func IsValidMnemonic(mnemonic string) bool {
+	return bip39.IsMnemonicValid(mnemonic)
+}
+
+// return derivation path of the index-th key, index 0 is DefaultHDPath
+func HDPathByIndex(index uint32) string {
+	return fmt.Sprintf("m/44'/3077'/0'/0/%d", index)
+}
+
+// generate private key and public key from mnemonic with a derivation path
+func GenerateKeyPairFromMnemonicWithPath(mnemonic, hdPath string) (string, string, error) {
 	seed := bip39.NewSeed(mnemonic, "")
 	path, err := ParseDerivationPath(hdPath)
 	if err != nil {
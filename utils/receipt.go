@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+)
+
+var (
+	ErrNoInvoice = errors.New("response contains no invoice")
+)
+
+// TrxError is returned when a transaction reached the chain but was not applied successfully
+type TrxError struct {
+	Status uint32
+	Msg    string
+}
+
+func (e *TrxError) Error() string {
+	return fmt.Sprintf("transaction failed, status: %d, error: %s", e.Status, e.Msg)
+}
+
+// OpResult is the execution result of a single operation inside a transaction
+type OpResult struct {
+	Status    uint32
+	GasUsage  uint64
+	VmConsole string // output of contract apply
+}
+
+// check if the operation is executed successfully
+func (r *OpResult) Succeeded() bool {
+	return r.Status == prototype.StatusSuccess
+}
+
+// Receipt is a decoded invoice of a broadcast transaction
+type Receipt struct {
+	Status    uint32
+	ErrorInfo string
+	NetUsage  uint64
+	CpuUsage  uint64
+	OpResults []*OpResult
+	Finality  bool
+}
+
+// decode receipt from a broadcast response
+// return ErrNoInvoice if node only delivered the transaction without waiting for result
+func NewReceipt(res *grpcpb.BroadcastTrxResponse) (*Receipt, error) {
+	if res == nil {
+		return nil, errors.New("response == nil")
+	}
+	if res.Invoice == nil {
+		if res.Status != 0 && res.Status != prototype.StatusSuccess {
+			return nil, &TrxError{Status: res.Status, Msg: res.Msg}
+		}
+		return nil, ErrNoInvoice
+	}
+	r := NewReceiptFromInvoice(res.Invoice)
+	r.Finality = res.Finality
+	return r, nil
+}
+
+// decode receipt from a raw invoice, e.g. the one returned by EstimateStamina
+func NewReceiptFromInvoice(invoice *prototype.TransactionReceiptWithInfo) *Receipt {
+	r := &Receipt{
+		Status:    invoice.Status,
+		ErrorInfo: invoice.ErrorInfo,
+		NetUsage:  invoice.NetUsage,
+		CpuUsage:  invoice.CpuUsage,
+	}
+	for _, op := range invoice.OpResults {
+		if op == nil {
+			continue
+		}
+		r.OpResults = append(r.OpResults, &OpResult{
+			Status:    op.Status,
+			GasUsage:  op.GasUsage,
+			VmConsole: op.VmConsole,
+		})
+	}
+	return r
+}
+
+// check if the transaction is applied successfully
+func (r *Receipt) Succeeded() bool {
+	return r.Status == prototype.StatusSuccess
+}
+
+// check if the transaction is executed, a failed transaction still cost stamina
+func (r *Receipt) Executed() bool {
+	return r.Status == prototype.StatusSuccess || r.Status == prototype.StatusFailDeductStamina
+}
+
+// return total stamina the transaction consumed
+func (r *Receipt) StaminaUsage() uint64 {
+	return r.NetUsage + r.CpuUsage
+}
+
+// return nil if transaction succeeded, otherwise a *TrxError
+func (r *Receipt) Err() error {
+	if r.Succeeded() {
+		return nil
+	}
+	return &TrxError{Status: r.Status, Msg: r.ErrorInfo}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"errors"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"testing"
+)
+
+func TestNewReceipt(t *testing.T) {
+	res := &grpcpb.BroadcastTrxResponse{
+		Invoice: &prototype.TransactionReceiptWithInfo{
+			Status:   prototype.StatusSuccess,
+			NetUsage: 10,
+			CpuUsage: 20,
+			OpResults: []*prototype.OperationReceiptWithInfo{
+				{Status: prototype.StatusSuccess, GasUsage: 5, VmConsole: "ok"},
+				nil,
+			},
+		},
+		Finality: true,
+	}
+	r, err := NewReceipt(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Succeeded() || !r.Executed() || r.Err() != nil || !r.Finality {
+		t.Fatalf("receipt %+v is not a succeeded and final transaction", r)
+	}
+	if r.StaminaUsage() != 30 {
+		t.Fatalf("stamina usage %d, want 30", r.StaminaUsage())
+	}
+	if len(r.OpResults) != 1 || !r.OpResults[0].Succeeded() || r.OpResults[0].GasUsage != 5 || r.OpResults[0].VmConsole != "ok" {
+		t.Fatalf("got op results %+v", r.OpResults)
+	}
+}
+
+func TestFailedReceipt(t *testing.T) {
+	r := NewReceiptFromInvoice(&prototype.TransactionReceiptWithInfo{
+		Status:    prototype.StatusFailDeductStamina,
+		ErrorInfo: "insufficient balance",
+		CpuUsage:  7,
+	})
+	if r.Succeeded() || !r.Executed() || r.StaminaUsage() != 7 {
+		t.Fatalf("receipt %+v is not a failed but executed transaction", r)
+	}
+	var terr *TrxError
+	if !errors.As(r.Err(), &terr) || terr.Status != prototype.StatusFailDeductStamina || terr.Msg != "insufficient balance" {
+		t.Fatalf("got error %v", r.Err())
+	}
+}
+
+func TestReceiptWithoutInvoice(t *testing.T) {
+	if _, err := NewReceipt(&grpcpb.BroadcastTrxResponse{Status: prototype.StatusSuccess}); err != ErrNoInvoice {
+		t.Fatalf("delivered transaction got %v", err)
+	}
+	if _, err := NewReceipt(&grpcpb.BroadcastTrxResponse{}); err != ErrNoInvoice {
+		t.Fatalf("empty response got %v", err)
+	}
+	var terr *TrxError
+	_, err := NewReceipt(&grpcpb.BroadcastTrxResponse{Status: prototype.StatusError, Msg: "rejected"})
+	if !errors.As(err, &terr) || terr.Status != prototype.StatusError || terr.Msg != "rejected" {
+		t.Fatalf("rejected transaction got %v", err)
+	}
+	if _, err := NewReceipt(nil); err == nil {
+		t.Fatal("nil response is decoded")
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/coschain/contentos-go/common"
+	"github.com/coschain/contentos-go/prototype"
+	"sort"
+)
+
+var (
+	ErrMerkleRootMismatch = errors.New("transaction merkle root mismatch")
+	ErrEmptyBlock         = errors.New("block has no signed header")
+)
+
+// SignerError is returned when a signature is valid but made by an unexpected key
+type SignerError struct {
+	Name     string // authority account, or block producer
+	Expected string
+	Actual   string
+}
+
+func (e *SignerError) Error() string {
+	return fmt.Sprintf("%s is not the signer, expected key: %s, actual key: %s", e.Name, e.Expected, e.Actual)
+}
+
+// recover the public key who signed a transaction for a certain chain
+func RecoverTrxSigner(trx *prototype.SignedTransaction, chainId ChainId) (*prototype.PublicKeyType, error) {
+	if err := trx.Validate(); err != nil {
+		return nil, err
+	}
+	return trx.ExportPubKeys(prototype.ChainId{Value: common.GetChainIdByName(string(chainId))})
+}
+
+// check if a transaction is signed by the WIF public key for a certain chain
+func VerifyTrxSignature(trx *prototype.SignedTransaction, pubKey string, chainId ChainId) bool {
+	key, err := prototype.PublicKeyFromWIF(pubKey)
+	if err != nil {
+		return false
+	}
+	if trx.Validate() != nil {
+		return false
+	}
+	return trx.VerifySig(key, prototype.ChainId{Value: common.GetChainIdByName(string(chainId))})
+}
+
+// return sorted names of accounts whose authority the transaction's operations require
+func TrxAuthorities(trx *prototype.SignedTransaction) []string {
+	var names []string
+	for name := range trx.GetOpCreatorsMap() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recover the public key who signed a block
+func RecoverBlockSigner(block *prototype.SignedBlock) (*prototype.PublicKeyType, error) {
+	if block == nil || block.SignedHeader == nil || block.SignedHeader.Header == nil {
+		return nil, ErrEmptyBlock
+	}
+	if block.SignedHeader.BlockProducerSignature == nil {
+		return nil, ErrInvalidSignature
+	}
+	hash := block.SignedHeader.Header.Hash()
+	return recoverPubKey(hash[:], block.SignedHeader.BlockProducerSignature.Sig)
+}
+
+// check if the transaction merkle root in block header matches the transactions
+func VerifyBlockMerkleRoot(block *prototype.SignedBlock) error {
+	if block == nil || block.SignedHeader == nil || block.SignedHeader.Header == nil {
+		return ErrEmptyBlock
+	}
+	for _, trx := range block.Transactions {
+		if trx == nil || trx.SigTrx == nil {
+			return ErrMerkleRootMismatch
+		}
+	}
+	root := block.SignedHeader.Header.TransactionMerkleRoot
+	if root == nil {
+		return ErrMerkleRootMismatch
+	}
+	calc := block.CalculateMerkleRoot()
+	if !bytes.Equal(root.Hash, calc.Data[:]) {
+		return ErrMerkleRootMismatch
+	}
+	return nil
+}
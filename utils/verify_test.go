@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/coschain/contentos-go/common"
+	"github.com/coschain/contentos-go/prototype"
+	"reflect"
+	"testing"
+)
+
+// signatures of the transaction and block built below, signed by testKey on dev chain and by testKey2
+const (
+	trxSigVector   = "e58f0336577680b4020e8198d8dac901185d3f9db05e356639d7d3fee1cc662e48dccc3d16c31b7d541568fd6b5bd571c7885e6ad35e0dc4a0376ee262589aba01"
+	blockSigVector = "a34b3093250f1eab3a5c52c82b889cbbbf1b7bfa3fff8fcab1466a1d11932150076198cf910763a868a2c56e53f879b34383dce0ec9701579437e854499c232601"
+)
+
+func newTestTrx() *prototype.SignedTransaction {
+	trx := &prototype.Transaction{RefBlockNum: 1, RefBlockPrefix: 2, Expiration: &prototype.TimePointSec{UtcSeconds: 1600000000}}
+	trx.AddOperation(&prototype.TransferOperation{
+		From:   prototype.NewAccountName("alice1"),
+		To:     prototype.NewAccountName("bobby1"),
+		Amount: prototype.NewCoin(1),
+		Memo:   "vector",
+	})
+	sig, _ := hex.DecodeString(trxSigVector)
+	return &prototype.SignedTransaction{Trx: trx, Signature: &prototype.SignatureType{Sig: sig}}
+}
+
+func newTestBlock() *prototype.SignedBlock {
+	block := &prototype.SignedBlock{
+		SignedHeader: &prototype.SignedBlockHeader{
+			Header: &prototype.BlockHeader{
+				Previous:      &prototype.Sha256{Hash: make([]byte, 32)},
+				Timestamp:     &prototype.TimePointSec{UtcSeconds: 1600000000},
+				BlockProducer: prototype.NewAccountName("carol1"),
+			},
+		},
+		Transactions: []*prototype.TransactionWrapper{{SigTrx: newTestTrx(), Receipt: &prototype.TransactionReceipt{Status: prototype.StatusSuccess}}},
+	}
+	root := block.CalculateMerkleRoot()
+	block.SignedHeader.Header.TransactionMerkleRoot = &prototype.Sha256{Hash: root.Data[:]}
+	sig, _ := hex.DecodeString(blockSigVector)
+	block.SignedHeader.BlockProducerSignature = &prototype.SignatureType{Sig: sig}
+	return block
+}
+
+func TestVerifyTrxVector(t *testing.T) {
+	trx := newTestTrx()
+	key, _ := prototype.PrivateKeyFromWIF(testKey)
+	unsigned := &prototype.SignedTransaction{Trx: trx.Trx}
+	if sig := hex.EncodeToString(unsigned.Sign(key, prototype.ChainId{Value: common.GetChainIdByName(string(Dev))})); sig != trxSigVector {
+		t.Fatalf("got signature %s, want %s", sig, trxSigVector)
+	}
+
+	signer, err := RecoverTrxSigner(trx, Dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.ToWIF() != testPubKey {
+		t.Fatalf("recovered signer %s, want %s", signer.ToWIF(), testPubKey)
+	}
+	if !VerifyTrxSignature(trx, testPubKey, Dev) {
+		t.Fatal("signature is not verified")
+	}
+	if names := TrxAuthorities(trx); !reflect.DeepEqual(names, []string{"alice1"}) {
+		t.Fatalf("got authorities %v", names)
+	}
+}
+
+func TestVerifyTrxRejects(t *testing.T) {
+	if VerifyTrxSignature(newTestTrx(), testPubKey2, Dev) {
+		t.Fatal("verified with another key")
+	}
+	if VerifyTrxSignature(newTestTrx(), testPubKey, Main) {
+		t.Fatal("verified on another chain")
+	}
+	if signer, err := RecoverTrxSigner(newTestTrx(), Main); err == nil && signer.ToWIF() == testPubKey {
+		t.Fatal("recovered the signer on another chain")
+	}
+
+	trx := newTestTrx()
+	trx.Trx.Operations[0].GetOp2().Amount = prototype.NewCoin(2)
+	if VerifyTrxSignature(trx, testPubKey, Dev) {
+		t.Fatal("verified a changed transaction")
+	}
+	if VerifyTrxSignature(newTestTrx(), "bad key", Dev) {
+		t.Fatal("verified with an invalid key")
+	}
+
+	trx = newTestTrx()
+	trx.Signature.Sig = trx.Signature.Sig[:64]
+	if _, err := RecoverTrxSigner(trx, Dev); err == nil {
+		t.Fatal("recovered a short signature")
+	}
+}
+
+func TestVerifyBlockVector(t *testing.T) {
+	block := newTestBlock()
+	key, _ := prototype.PrivateKeyFromWIF(testKey2)
+	header := &prototype.SignedBlockHeader{Header: block.SignedHeader.Header, BlockProducerSignature: &prototype.SignatureType{}}
+	if err := header.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if sig := hex.EncodeToString(header.BlockProducerSignature.Sig); sig != blockSigVector {
+		t.Fatalf("got signature %s, want %s", sig, blockSigVector)
+	}
+
+	if err := VerifyBlockMerkleRoot(block); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := RecoverBlockSigner(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.ToWIF() != testPubKey2 {
+		t.Fatalf("recovered producer %s, want %s", signer.ToWIF(), testPubKey2)
+	}
+}
+
+func TestVerifyBlockRejects(t *testing.T) {
+	block := newTestBlock()
+	block.Transactions[0].SigTrx.Trx.Operations[0].GetOp2().Memo = "changed"
+	if err := VerifyBlockMerkleRoot(block); err != ErrMerkleRootMismatch {
+		t.Fatalf("changed transaction got %v", err)
+	}
+	block = newTestBlock()
+	block.Transactions = append(block.Transactions, block.Transactions[0])
+	if err := VerifyBlockMerkleRoot(block); err != ErrMerkleRootMismatch {
+		t.Fatalf("added transaction got %v", err)
+	}
+	block = newTestBlock()
+	block.SignedHeader.Header.TransactionMerkleRoot = nil
+	if err := VerifyBlockMerkleRoot(block); err != ErrMerkleRootMismatch {
+		t.Fatalf("block without merkle root got %v", err)
+	}
+
+	// a changed header is signed by someone else
+	block = newTestBlock()
+	block.SignedHeader.Header.Timestamp.UtcSeconds++
+	if signer, err := RecoverBlockSigner(block); err == nil && signer.ToWIF() == testPubKey2 {
+		t.Fatal("recovered the producer of a changed header")
+	}
+	block = newTestBlock()
+	block.SignedHeader.BlockProducerSignature = nil
+	if _, err := RecoverBlockSigner(block); err != ErrInvalidSignature {
+		t.Fatalf("block without signature got %v", err)
+	}
+	for _, block := range []*prototype.SignedBlock{nil, {}, {SignedHeader: &prototype.SignedBlockHeader{}}} {
+		if _, err := RecoverBlockSigner(block); !errors.Is(err, ErrEmptyBlock) {
+			t.Fatalf("empty block got %v", err)
+		}
+		if err := VerifyBlockMerkleRoot(block); !errors.Is(err, ErrEmptyBlock) {
+			t.Fatalf("empty block got %v", err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package wallet
+
+import (
+	"github.com/kataras/go-errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contacts are saved in storage with this prefix, which can't be in an account name on chain
+const contactKeyPrefix = "#contact/"
+
+var ErrInvalidContact = errors.New("contact name can't be empty")
+
+// Contact is an external account in address book, e.g. a counterparty, its key is not in wallet
+type Contact struct {
+	Name        string `json:"name"`
+	Metadata           // labels, notes and tags
+	CreatedTime int64  `json:"created_time,omitempty"` // unix seconds, when the contact is added
+}
+
+// return a deep copy of contact
+func (c *Contact) Copy() *Contact {
+	cc := *c
+	cc.Metadata = c.Metadata.copy()
+	return &cc
+}
+
+func contactKey(name string) string {
+	return contactKeyPrefix + name
+}
+
+func isContactKey(key string) bool {
+	return strings.HasPrefix(key, contactKeyPrefix)
+}
+
+// decrypt a contact saved under key, return it with the sequence number of its entry
+func openContact(dataKey []byte, key string, data []byte) (*Contact, uint64, error) {
+	var c Contact
+	seq, err := openJSON(dataKey, key, data, &c)
+	if err != nil || contactKey(c.Name) != key {
+		return nil, 0, ErrKeyStoreCorrupted
+	}
+	return &c, seq, nil
+}
+
+// return a copy of contact name in address book, nil if not found
+func (w *BaseWallet) GetContact(name string) *Contact {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	c, ok := w.contacts[name]
+	if !ok {
+		return nil
+	}
+	return c.Copy()
+}
+
+// return copies of all contacts in address book, sorted by name
+func (w *BaseWallet) GetAllContacts() []*Contact {
+	return w.filterContacts(func(c *Contact) bool {
+		return true
+	})
+}
+
+// return copies of contacts whose name or metadata contains query case-insensitively, sorted by name
+func (w *BaseWallet) SearchContacts(query string) []*Contact {
+	query = strings.ToLower(query)
+	return w.filterContacts(func(c *Contact) bool {
+		return strings.Contains(strings.ToLower(c.Name), query) || c.Metadata.contains(query)
+	})
+}
+
+// return copies of contacts with label, sorted by name
+func (w *BaseWallet) ContactsByLabel(label string) []*Contact {
+	return w.filterContacts(func(c *Contact) bool {
+		return c.HasLabel(label)
+	})
+}
+
+func (w *BaseWallet) filterContacts(match func(c *Contact) bool) []*Contact {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	var contacts []*Contact
+	for _, c := range w.contacts {
+		if match(c) {
+			contacts = append(contacts, c.Copy())
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].Name < contacts[j].Name
+	})
+	return contacts
+}
+
+// return a contact to be added, creation time is kept if it's already in address book
+func (w *BaseWallet) newContact(name string, m Metadata) (*Contact, error) {
+	if name == "" {
+		return nil, ErrInvalidContact
+	}
+	c := &Contact{Name: name, Metadata: m.copy(), CreatedTime: time.Now().Unix()}
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	if old, ok := w.contacts[name]; ok {
+		c.CreatedTime = old.CreatedTime
+	}
+	return c, nil
+}
+
+// add an external account to address book, or replace its metadata if it's already there
+func (w *MemWallet) AddContact(name string, m Metadata) error {
+	c, err := w.newContact(name, m)
+	if err != nil {
+		return err
+	}
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.contacts == nil {
+		return ErrWalletClosed
+	}
+	w.contacts[name] = c
+	return nil
+}
+
+func (w *MemWallet) RemoveContact(name string) error {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.contacts == nil {
+		return ErrWalletClosed
+	}
+	delete(w.contacts, name)
+	return nil
+}
+
+// add an external account to address book, or replace its metadata if it's already there
+// contacts are encrypted in keystore like accounts
+func (w *KeyStoreWallet) AddContact(name string, m Metadata) error {
+	c, err := w.newContact(name, m)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.putContact(c)
+}
+
+// encrypt and save a contact, caller must hold w.mu
+func (w *KeyStoreWallet) putContact(c *Contact) error {
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	if err := w.syncHeader(); err != nil {
+		return err
+	}
+	seq := w.counter + 1
+	data, err := sealJSON(w.dataKey, contactKey(c.Name), seq, c)
+	if err != nil {
+		return err
+	}
+	if err := w.saveEntry(contactKey(c.Name), seq, data); err != nil {
+		return err
+	}
+	w.setContact(c.Name, c)
+	return nil
+}
+
+func (w *KeyStoreWallet) RemoveContact(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	if err := w.syncHeader(); err != nil {
+		return err
+	}
+	if err := w.saveEntry(contactKey(name), w.counter+1, nil); err != nil {
+		return err
+	}
+	w.setContact(name, nil)
+	return nil
+}
+
+// set contact of name, or delete it if c is nil, caller must hold w.mu
+func (w *KeyStoreWallet) setContact(name string, c *Contact) {
+	delete(w.damaged, contactKey(name))
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if c == nil {
+		delete(w.contacts, name)
+		return
+	}
+	w.contacts[name] = c
+}
@@ -0,0 +1,420 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+	"sort"
+	"time"
+)
+
+// version of BackupBundle, increase it when the format changes
+const BackupVersion = 1
+
+var (
+	ErrBackupChecksum  = errors.New("backup bundle is damaged, checksum mismatch")
+	ErrBackupCorrupted = errors.New("backup bundle is corrupted or modified")
+)
+
+// BackupBundle is an encrypted backup of accounts and contacts, encoded in json
+// it's encrypted with its own passphrase, independent of any keystore, and can be restored into any wallet
+type BackupBundle struct {
+	Version     int
+	CreatedTime int64 // unix seconds
+	Kdf         string
+	KdfParams   *utils.KdfParams
+	Salt        string
+	Mac         string // mac of a fixed message, tells whether passphrase is correct
+	Nonce       string
+	CipherText  string // aes-gcm encrypted BackupContent, fields above are authenticated as associated data
+	Checksum    string // hex sha256 of all fields above, damage is detected without passphrase
+}
+
+// BackupContent is the decrypted payload of a backup bundle
+type BackupContent struct {
+	Version  int        `json:"version"`
+	Accounts []*Record  `json:"accounts"`
+	Contacts []*Contact `json:"contacts,omitempty"`
+}
+
+// BackupOptions selects what is exported, a nil *BackupOptions exports all accounts and contacts
+type BackupOptions struct {
+	Accounts  []string         // names of accounts to export, all accounts if empty
+	Contacts  bool             // export address book
+	KdfParams *utils.KdfParams // scrypt parameters for passphrase, utils.DefaultKdfParams if nil
+}
+
+// ConflictPolicy decides what to do if an account in backup is in wallet with a different key
+type ConflictPolicy int
+
+const (
+	// nothing is restored, return ErrAccountExists
+	ConflictFail ConflictPolicy = iota
+	// keep the account in wallet
+	ConflictSkip
+	// replace the account in wallet by the one in backup
+	ConflictOverwrite
+)
+
+// RestoreResult is what a restore did, by account names
+type RestoreResult struct {
+	Restored  []string
+	Skipped   []string // already in wallet with the same key, or skipped by ConflictSkip
+	Conflicts []string // in wallet with a different key
+	Contacts  []string // restored contacts
+}
+
+// return everything authenticated by cipher text, which is also covered by checksum
+func (b *BackupBundle) header() ([]byte, error) {
+	h := *b
+	h.Nonce = ""
+	h.CipherText = ""
+	h.Checksum = ""
+	return json.Marshal(&h)
+}
+
+func (b *BackupBundle) checksum() (string, error) {
+	h := *b
+	h.Checksum = ""
+	data, err := json.Marshal(&h)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// return copies of what is exported by opts
+func (w *BaseWallet) backupContent(opts *BackupOptions) (*BackupContent, error) {
+	if opts == nil {
+		opts = &BackupOptions{Contacts: true}
+	}
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	if w.records == nil {
+		return nil, ErrWalletClosed
+	}
+	content := &BackupContent{Version: BackupVersion}
+	names := opts.Accounts
+	if len(names) == 0 {
+		for name := range w.records {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		r, ok := w.records[name]
+		if !ok {
+			return nil, errors.New("account not in wallet: " + name)
+		}
+		// private keys are cleared when a keystore wallet is locked
+		if !r.WatchOnly && r.PrivateKey == "" {
+			return nil, ErrWalletLocked
+		}
+		content.Accounts = append(content.Accounts, r.Copy())
+	}
+	if opts.Contacts {
+		for _, c := range w.contacts {
+			content.Contacts = append(content.Contacts, c.Copy())
+		}
+		sort.Slice(content.Contacts, func(i, j int) bool {
+			return content.Contacts[i].Name < content.Contacts[j].Name
+		})
+	}
+	return content, nil
+}
+
+// encrypt content into a backup bundle with passphrase
+func sealBackup(content *BackupContent, passphrase string, opts *BackupOptions) ([]byte, error) {
+	params := utils.DefaultKdfParams
+	if opts != nil && opts.KdfParams != nil {
+		params = *opts.KdfParams
+	}
+	salt, err := utils.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+	encKey, macKey, err := utils.DeriveKey([]byte(passphrase), salt, params)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(encKey)
+	defer utils.ZeroBytes(macKey)
+
+	b := &BackupBundle{
+		Version:     BackupVersion,
+		CreatedTime: time.Now().Unix(),
+		Kdf:         utils.KdfScrypt,
+		KdfParams:   &params,
+		Salt:        base64.StdEncoding.EncodeToString(salt),
+		Mac:         base64.StdEncoding.EncodeToString(passwordCheck(macKey)),
+	}
+	header, err := b.header()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(data)
+	cipherData, nonce, err := utils.SealData(data, encKey, header)
+	if err != nil {
+		return nil, err
+	}
+	b.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	b.CipherText = base64.StdEncoding.EncodeToString(cipherData)
+	if b.Checksum, err = b.checksum(); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// decrypt a backup bundle, return ErrBackupChecksum if it's damaged, ErrWrongPassword if passphrase is incorrect
+func ReadBackup(data []byte, passphrase string) (*BackupContent, error) {
+	var b BackupBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	if b.Version != BackupVersion {
+		return nil, errors.New(fmt.Sprintf("unsupported backup version %d", b.Version))
+	}
+	if sum, err := b.checksum(); err != nil || sum != b.Checksum {
+		return nil, ErrBackupChecksum
+	}
+	// params are from the bundle, bound them before deriving
+	if b.Kdf != utils.KdfScrypt || b.KdfParams == nil || b.KdfParams.Validate() != nil {
+		return nil, ErrBackupCorrupted
+	}
+	salt, err := base64.StdEncoding.DecodeString(b.Salt)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	check, err := base64.StdEncoding.DecodeString(b.Mac)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	nonce, err := base64.StdEncoding.DecodeString(b.Nonce)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	cipherData, err := base64.StdEncoding.DecodeString(b.CipherText)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	encKey, macKey, err := utils.DeriveKey([]byte(passphrase), salt, *b.KdfParams)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	defer utils.ZeroBytes(encKey)
+	defer utils.ZeroBytes(macKey)
+	if !hmac.Equal(check, passwordCheck(macKey)) {
+		return nil, ErrWrongPassword
+	}
+	header, err := b.header()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := utils.OpenData(cipherData, encKey, nonce, header)
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	defer utils.ZeroBytes(plain)
+	var content BackupContent
+	if err := json.Unmarshal(plain, &content); err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	for _, r := range content.Accounts {
+		if r == nil || r.Name == "" || isContactKey(r.Name) || restorePublicKey(r) != nil {
+			return nil, ErrBackupCorrupted
+		}
+	}
+	for _, c := range content.Contacts {
+		if c == nil || c.Name == "" {
+			return nil, ErrBackupCorrupted
+		}
+	}
+	return &content, nil
+}
+
+// public key of a restored account is derived from its private key as NewRecord does, the one in bundle isn't trusted
+// a watch-only account may have none, as AddWatchOnly of a wallet importing offline
+func restorePublicKey(r *Record) error {
+	if r.WatchOnly {
+		if r.PublicKey == "" {
+			return nil
+		}
+		_, err := prototype.PublicKeyFromWIF(r.PublicKey)
+		return err
+	}
+	privKey, err := prototype.PrivateKeyFromWIF(r.PrivateKey)
+	if err != nil {
+		return err
+	}
+	pubKey, err := privKey.PubKey()
+	if err != nil {
+		return err
+	}
+	r.PublicKey = pubKey.ToWIF()
+	return nil
+}
+
+// decide which accounts in backup are restored, caller must hold a lock of dataMu
+// policy and tally of an account in wallet are kept, so a restore can't lift a policy or reset the daily limit,
+// and so are its staged and archived keys
+// on ConflictFail, result has conflicts and nothing is restored
+func (w *BaseWallet) planRestore(content *BackupContent, policy ConflictPolicy) ([]*Record, []*Contact, *RestoreResult, error) {
+	result := &RestoreResult{}
+	var records []*Record
+	for _, r := range content.Accounts {
+		old, ok := w.records[r.Name]
+		switch {
+		case !ok:
+		case sameKey(old, r):
+			result.Skipped = append(result.Skipped, r.Name)
+			continue
+		// a watch-only account in wallet gets its key
+		case old.WatchOnly && !r.WatchOnly:
+		// never drop a key for a watch-only account
+		case r.WatchOnly && !old.WatchOnly:
+			result.Skipped = append(result.Skipped, r.Name)
+			continue
+		default:
+			result.Conflicts = append(result.Conflicts, r.Name)
+			if policy != ConflictOverwrite {
+				result.Skipped = append(result.Skipped, r.Name)
+				continue
+			}
+		}
+		if ok {
+			r.Policy, r.Spending = nil, nil
+			keepPolicy(r, old)
+			keepRotation(r, old)
+		}
+		records = append(records, r)
+	}
+	if len(result.Conflicts) > 0 && policy == ConflictFail {
+		return nil, nil, &RestoreResult{Conflicts: result.Conflicts}, ErrAccountExists
+	}
+	var contacts []*Contact
+	for _, c := range content.Contacts {
+		// contacts in wallet are kept unless overwritten
+		if _, ok := w.contacts[c.Name]; ok && policy != ConflictOverwrite {
+			continue
+		}
+		contacts = append(contacts, c)
+	}
+	return records, contacts, result, nil
+}
+
+// check accounts in backup as they are added, see ValidateKey and AddWatchOnly
+// an empty public key of a watch-only account is filled with its on-chain key
+func (w *BaseWallet) validateRestore(content *BackupContent) error {
+	for _, r := range content.Accounts {
+		if !r.WatchOnly {
+			if err := w.ValidateKey(r.Name, r.PrivateKey); err != nil {
+				return err
+			}
+			continue
+		}
+		checked, err := w.newWatchOnlyRecord(r.Name, r.PublicKey, nil)
+		if err != nil {
+			return err
+		}
+		r.PublicKey = checked.PublicKey
+	}
+	return nil
+}
+
+func sameKey(a, b *Record) bool {
+	if a.WatchOnly || b.WatchOnly {
+		return a.WatchOnly == b.WatchOnly && a.PublicKey == b.PublicKey
+	}
+	return a.PrivateKey == b.PrivateKey
+}
+
+// export accounts and contacts selected by opts to a backup bundle encrypted with passphrase
+// return ErrWalletLocked if it's a locked keystore wallet
+func (w *BaseWallet) ExportBackup(passphrase string, opts *BackupOptions) ([]byte, error) {
+	content, err := w.backupContent(opts)
+	if err != nil {
+		return nil, err
+	}
+	return sealBackup(content, passphrase, opts)
+}
+
+// restore accounts and contacts in a backup bundle
+// unless the wallet imports offline, keys are checked against the chain, nothing is restored if one doesn't match
+func (w *MemWallet) RestoreBackup(data []byte, passphrase string, policy ConflictPolicy) (*RestoreResult, error) {
+	content, err := ReadBackup(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.validateRestore(content); err != nil {
+		return nil, err
+	}
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return nil, ErrWalletClosed
+	}
+	records, contacts, result, err := w.planRestore(content, policy)
+	if err != nil {
+		return result, err
+	}
+	for _, r := range records {
+		w.setRecord(r)
+		result.Restored = append(result.Restored, r.Name)
+	}
+	for _, c := range contacts {
+		w.contacts[c.Name] = c
+		result.Contacts = append(result.Contacts, c.Name)
+	}
+	return result, nil
+}
+
+// restore accounts and contacts in a backup bundle
+// unless the wallet imports offline, keys are checked against the chain, nothing is restored if one doesn't match
+// each account is saved separately, if saving fails, result has what is restored before
+func (w *KeyStoreWallet) RestoreBackup(data []byte, passphrase string, policy ConflictPolicy) (*RestoreResult, error) {
+	content, err := ReadBackup(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.validateRestore(content); err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storage == nil {
+		return nil, errNotOpen
+	}
+	if w.locked {
+		return nil, ErrWalletLocked
+	}
+	w.dataMu.RLock()
+	records, contacts, result, err := w.planRestore(content, policy)
+	w.dataMu.RUnlock()
+	if err != nil {
+		return result, err
+	}
+	for _, r := range records {
+		if err := w.put(r); err != nil {
+			return result, err
+		}
+		result.Restored = append(result.Restored, r.Name)
+	}
+	for _, c := range contacts {
+		if err := w.putContact(c); err != nil {
+			return result, err
+		}
+		result.Contacts = append(result.Contacts, c.Name)
+	}
+	return result, nil
+}
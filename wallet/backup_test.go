@@ -0,0 +1,72 @@
+package wallet
+
+import (
+	"github.com/coschain/cos-sdk-go/utils"
+	"testing"
+)
+
+// a backup of a memory wallet importing offline, with a watch-only account without public key
+func newTestBackup(t *testing.T, ip string) []byte {
+	w := NewMemWallet(ip, utils.Dev, WithOfflineImport())
+	defer w.Close()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddWatchOnly("bobby1", ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.ExportBackup("passphrase", &BackupOptions{KdfParams: &utils.KdfParams{N: 1 << 10, R: 8, P: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey, "bobby1": testPubKey2})
+	ip := startNode(t, node)
+	data := newTestBackup(t, ip)
+
+	offline := newTestKeyStoreWallet(t, ip)
+	result, err := offline.RestoreBackup(data, "passphrase", ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Restored) != 2 {
+		t.Fatalf("got result %+v", result)
+	}
+	if key, err := offline.ExportPrivateKey("alice1"); err != nil || key != testKey {
+		t.Fatalf("got key %s, error %v", key, err)
+	}
+	if r := offline.GetRecord("bobby1"); r == nil || !r.WatchOnly || r.PublicKey != "" {
+		t.Fatalf("got record %+v", r)
+	}
+
+	// checked against the chain, the key of the watch-only account is filled
+	online := NewMemWallet(ip, utils.Dev)
+	defer online.Close()
+	if _, err := online.RestoreBackup(data, "passphrase", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if r := online.GetRecord("bobby1"); r == nil || !r.WatchOnly || r.PublicKey != testPubKey2 {
+		t.Fatalf("got record %+v", r)
+	}
+}
+
+func TestRestoreChecksChain(t *testing.T) {
+	ip := startNode(t, newFakeNode(map[string]string{"alice1": testPubKey2, "bobby1": testPubKey2}))
+	data := newTestBackup(t, ip)
+
+	w := NewMemWallet(ip, utils.Dev)
+	defer w.Close()
+	_, err := w.RestoreBackup(data, "passphrase", ConflictFail)
+	if kerr, ok := err.(*KeyMismatchError); !ok || kerr.Name != "alice1" || kerr.OnChainKey != testPubKey2 {
+		t.Fatalf("restore got %v", err)
+	}
+	if n := len(w.GetAllAccounts()); n != 0 {
+		t.Fatalf("%d accounts restored", n)
+	}
+	if _, err := ReadBackup(data, "wrong"); err != ErrWrongPassword {
+		t.Fatalf("wrong passphrase got %v", err)
+	}
+}
@@ -9,11 +9,31 @@ import (
 	"github.com/coschain/cos-sdk-go/rpcclient"
 	"github.com/coschain/cos-sdk-go/utils"
 	"math"
+	"sync"
 )
 
 type BaseWallet struct {
+	// guards accounts, records, contacts and content of them
+	// wallets change them with write lock held, while readers get copies with read lock
+	dataMu sync.RWMutex
 	accounts map[string]*account.Account
+	records map[string]*Record
+	// address book
+	contacts map[string]*Contact
 	chainId utils.ChainId
+	// set by WithOfflineImport when created, never changed
+	offlineImport bool
+	// set by constructors of wallets to themselves
+	store recordStore
+}
+
+// recordStore is how a wallet saves records, features on BaseWallet are written once against it
+type recordStore interface {
+	// validate the key of r and save it, metadata and policy of an account already in wallet are kept
+	// if replace is false, an account already in wallet is only upgraded from watch-only, see mergeRecord
+	addRecord(r *Record, replace bool) error
+	// update a copy of record name by f and save it, wallet must be unlocked
+	updateRecord(name string, f func(r *Record) error) error
 }
 
 // generate new public key and private key
@@ -41,14 +61,76 @@ func (w *BaseWallet) GenerateKeyPairFromMnemonic(mnemonic string) (string,string
 	return utils.GenerateKeyPairFromMnemonic(mnemonic)
 }
 
-// return account object
+// return a copy of account object, nil if not found
+// the copy has no private key, it signs with the wallet, so it follows later changes of wallet like lock
 func (w *BaseWallet) Account(name string) *account.Account {
-	return w.accounts[name]
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	acc, ok := w.accounts[name]
+	if !ok {
+		return nil
+	}
+	c := *acc
+	return &c
 }
 
-// return a map represent all accounts in wallet
+// return a map represent all accounts in wallet, both map and accounts are copies
 func (w *BaseWallet) GetAllAccounts() map[string]*account.Account {
-	return w.accounts
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	accounts := make(map[string]*account.Account, len(w.accounts))
+	for name, acc := range w.accounts {
+		c := *acc
+		accounts[name] = &c
+	}
+	return accounts
+}
+
+// return a copy of what wallet stores for an account, nil if not found
+// private keys are cleared in the copy, including staged and archived ones, see ExportPrivateKey
+func (w *BaseWallet) GetRecord(name string) *Record {
+	r := w.record(name)
+	if r != nil {
+		r.clearPrivateKeys()
+	}
+	return r
+}
+
+// return a full copy of record name with private keys, nil if not found
+func (w *BaseWallet) record(name string) *Record {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	r, ok := w.records[name]
+	if !ok {
+		return nil
+	}
+	return r.Copy()
+}
+
+// return the WIF private key of an account, it's the only getter of keys besides exports like ExportBackup
+// return ErrWatchOnly for a watch-only account, ErrWalletLocked if it's a locked keystore wallet
+func (w *BaseWallet) ExportPrivateKey(name string) (string, error) {
+	r := w.record(name)
+	if r == nil {
+		return "", errors.New("account not in wallet: " + name)
+	}
+	if r.WatchOnly {
+		return "", ErrWatchOnly
+	}
+	// private keys are cleared when a keystore wallet is locked
+	if r.PrivateKey == "" {
+		return "", ErrWalletLocked
+	}
+	return r.PrivateKey, nil
+}
+
+// decrypt a memo with the private key of an account in wallet
+func (w *BaseWallet) DecryptMemo(name, memo string) (string,error) {
+	acc := w.Account(name)
+	if acc == nil {
+		return "",errors.New("account not in wallet: " + name)
+	}
+	return acc.DecryptMemo(memo)
 }
 
 // return content of a contract' table
@@ -70,6 +152,67 @@ func (w *BaseWallet) GetAccountByName(name string) (*grpcpb.AccountResponse,erro
 	return rpcclient.GetRpc().GetAccountByName(context.Background(), req)
 }
 
+// verify an off-chain message is signed by the on-chain key of account name
+func (w *BaseWallet) VerifyMessage(name string, message []byte, signature string) (bool,error) {
+	res, err := w.GetAccountByName(name)
+	if err != nil {
+		return false,err
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		return false,errors.New("account not found")
+	}
+	signer, err := utils.RecoverMessageSigner(w.chainId, message, signature)
+	if err != nil {
+		return false,err
+	}
+	return signer == res.Info.PublicKey.ToWIF(),nil
+}
+
+// verify a transaction is signed for the wallet's chain by the on-chain key of every authority account
+func (w *BaseWallet) VerifyTransaction(trx *prototype.SignedTransaction) error {
+	signer, err := utils.RecoverTrxSigner(trx, w.chainId)
+	if err != nil {
+		return err
+	}
+	for _,name := range utils.TrxAuthorities(trx) {
+		res, err := w.GetAccountByName(name)
+		if err != nil {
+			return err
+		}
+		if res.Info == nil || res.Info.PublicKey == nil {
+			return errors.New("account not found: " + name)
+		}
+		if !res.Info.PublicKey.Equal(signer) {
+			return &utils.SignerError{Name:name, Expected:res.Info.PublicKey.ToWIF(), Actual:signer.ToWIF()}
+		}
+	}
+	return nil
+}
+
+// verify a block's transaction merkle root and producer signature
+// the signature is checked against producer's current signing key, so blocks signed before a key change fail
+func (w *BaseWallet) VerifyBlock(block *prototype.SignedBlock) error {
+	if err := utils.VerifyBlockMerkleRoot(block); err != nil {
+		return err
+	}
+	signer, err := utils.RecoverBlockSigner(block)
+	if err != nil {
+		return err
+	}
+	producer := block.SignedHeader.Header.BlockProducer.GetValue()
+	res, err := w.GetBlockProducerByName(producer)
+	if err != nil {
+		return err
+	}
+	if res.SigningKey == nil {
+		return errors.New("block producer not found: " + producer)
+	}
+	if !res.SigningKey.Equal(signer) {
+		return &utils.SignerError{Name:producer, Expected:res.SigningKey.ToWIF(), Actual:signer.ToWIF()}
+	}
+	return nil
+}
+
 // get one's all followers
 // pageSize : the amount of every page
 // use page manager's Next() to get value and type cast to GetFollowerListByNameResponse
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+const (
+	// the only format written by contentos-go wallet-cli
+	CliKeyFileVersion = 1
+	cliKeyFileCipher  = "AES-256"
+)
+
+var (
+	ErrCliKeyFileUnsupported = errors.New("unsupported wallet-cli key file")
+
+	cliKeyFileNameRegexp = regexp.MustCompile(`^COS-KEYJSON-(\w+)\.json$`)
+	cliAccountNameRegexp = regexp.MustCompile(`^\w+$`)
+)
+
+// CliKeyFile is the per-account key file of contentos-go wallet-cli, field names are kept for compatibility
+type CliKeyFile struct {
+	Name       string
+	PubKey     string
+	Cipher     string // aes algorithm
+	CipherText string // aes-ctr encrypted WIF private key, aes key is sha256 of passphrase
+	Iv         string
+	Mac        string // hmac-sha256 of private key with passphrase
+	Version    uint8
+}
+
+// return file name wallet-cli uses for an account
+func CliKeyFileName(name string) string {
+	return fmt.Sprintf("COS-KEYJSON-%s.json", name)
+}
+
+// return sorted paths of all wallet-cli key files in a directory
+func ListCliKeyFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		if !info.IsDir() && cliKeyFileNameRegexp.MatchString(info.Name()) {
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// decrypt a wallet-cli key file with its passphrase
+func ReadCliKeyFile(fileName, passphrase string) (*Record, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var kf CliKeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	if kf.Version != CliKeyFileVersion || kf.Cipher != cliKeyFileCipher {
+		return nil, ErrCliKeyFileUnsupported
+	}
+	if kf.Name == "" {
+		return nil, ErrKeyStoreCorrupted
+	}
+	iv, err := base64.StdEncoding.DecodeString(kf.Iv)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	cipherData, err := base64.StdEncoding.DecodeString(kf.CipherText)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	macData, err := base64.StdEncoding.DecodeString(kf.Mac)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	privKey, err := utils.DecryptData(cipherData, []byte(passphrase), iv)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(privKey)
+	if !hmac.Equal(macData, cliKeyFileMac(passphrase, privKey)) {
+		return nil, ErrWrongPassword
+	}
+	r := NewRecord(kf.Name, string(privKey))
+	r.Source = SourceCliKeyFile
+	// public key in file is not authenticated, it must match the private key
+	if r.PublicKey == "" || r.PublicKey != kf.PubKey {
+		return nil, ErrKeyStoreCorrupted
+	}
+	return r, nil
+}
+
+// encrypt an account to a wallet-cli key file in dir, return path of the file
+// an existing file is never overwritten
+func WriteCliKeyFile(dir string, r *Record, passphrase string) (string, error) {
+	if !cliAccountNameRegexp.MatchString(r.Name) {
+		return "", errors.New("account name can't be used as a wallet-cli file name: " + r.Name)
+	}
+	if r.PublicKey == "" {
+		return "", errors.New("invalid private key of account: " + r.Name)
+	}
+	fileName := filepath.Join(dir, CliKeyFileName(r.Name))
+	cipherData, iv, err := utils.EncryptData([]byte(r.PrivateKey), []byte(passphrase))
+	if err != nil {
+		return "", err
+	}
+	kf := &CliKeyFile{
+		Name:       r.Name,
+		PubKey:     r.PublicKey,
+		Cipher:     cliKeyFileCipher,
+		CipherText: base64.StdEncoding.EncodeToString(cipherData),
+		Iv:         base64.StdEncoding.EncodeToString(iv),
+		Mac:        base64.StdEncoding.EncodeToString(cliKeyFileMac(passphrase, []byte(r.PrivateKey))),
+		Version:    CliKeyFileVersion,
+	}
+	data, err := json.Marshal(kf)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileExclusive(fileName, data, 0600); err != nil {
+		if os.IsExist(err) {
+			return "", errors.New("file already exists: " + fileName)
+		}
+		return "", err
+	}
+	return fileName, nil
+}
+
+func cliKeyFileMac(passphrase string, privKey []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(passphrase))
+	mac.Write(privKey)
+	return mac.Sum(nil)
+}
+
+// import an account from a wallet-cli key file, return the account name
+// importing an account already in wallet with the same key does nothing
+func (w *KeyStoreWallet) ImportCliKeyFile(fileName, passphrase string) (string, error) {
+	r, err := ReadCliKeyFile(fileName, passphrase)
+	if err != nil {
+		return "", err
+	}
+	// a watch-only account becomes a signing one
+	if err := w.addRecord(r, false); err != nil {
+		return "", err
+	}
+	return r.Name, nil
+}
+
+// export an account to a wallet-cli key file in dir, encrypted with passphrase
+// the file can be loaded by wallet-cli, return path of the file
+func (w *KeyStoreWallet) ExportCliKeyFile(name, dir, passphrase string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.locked {
+		return "", ErrWalletLocked
+	}
+	r, ok := w.records[name]
+	if !ok {
+		return "", errors.New("account not in wallet: " + name)
+	}
+	if r.WatchOnly {
+		return "", ErrWatchOnly
+	}
+	return WriteCliKeyFile(dir, r, passphrase)
+}
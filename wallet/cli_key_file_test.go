@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// key files in testdata/wallet-cli are from testdata/keystore.json of contentos-go wallet-cli
+var cliKeyFileVectors = []struct {
+	name, passphrase, privateKey, publicKey string
+}{
+	{"testuser1", "123456", "3ApWCcYot48MeZshPaPFYAAvV2MmpJKca8SReu1nmxyfVhEEub", "COS6YY2o4tbHvbA1aC1fGijv5EC4tEdCNiVEQLrt5Qv4j2PFndiLE"},
+	{"testuser2", "abcdefg", "4TPq3agwZvQEGoQSppGaLrutwfJ4EcbXYTpq8Gxk6GR7RHgi4M", "COS6Rmj91piczS1REdHXAZ59iJwkhRdVuiPmQ5ewjJ72nuMmSertL"},
+	{"testuser3", "000000", "35LfqxFYb6waenaKXNW29q1vqYKVDCCVBtcQCdUiFkKoAXLdGX", "COS6znzq4ZESw6A2Zc54yAXFb6kaz2vuRhz331LR4LBFjAeqGuGoF"},
+}
+
+func TestReadCliKeyFileVectors(t *testing.T) {
+	files, err := ListCliKeyFiles(filepath.Join("testdata", "wallet-cli"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(cliKeyFileVectors) {
+		t.Fatalf("got files %v", files)
+	}
+	for i, v := range cliKeyFileVectors {
+		r, err := ReadCliKeyFile(files[i], v.passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		if r.Name != v.name || r.PrivateKey != v.privateKey || r.PublicKey != v.publicKey || r.Source != SourceCliKeyFile {
+			t.Fatalf("%s: got record %+v", v.name, r)
+		}
+		if _, err := ReadCliKeyFile(files[i], v.passphrase+"x"); err == nil {
+			t.Fatalf("%s: wrong passphrase is accepted", v.name)
+		}
+	}
+}
+
+func TestCliKeyFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fileName, err := WriteCliKeyFile(dir, NewRecord("alice1", testKey), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(fileName) != CliKeyFileName("alice1") {
+		t.Fatalf("got file %s", fileName)
+	}
+	r, err := ReadCliKeyFile(fileName, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "alice1" || r.PrivateKey != testKey {
+		t.Fatalf("got record %+v", r)
+	}
+	// never overwritten
+	if _, err := WriteCliKeyFile(dir, NewRecord("alice1", testKey2), "passphrase"); err == nil {
+		t.Fatal("existing key file is overwritten")
+	}
+	if r, err := ReadCliKeyFile(fileName, "passphrase"); err != nil || r.PrivateKey != testKey {
+		t.Fatalf("got record %+v, error %v", r, err)
+	}
+	if files, _ := ListCliKeyFiles(dir); len(files) != 1 {
+		t.Fatalf("got files %v", files)
+	}
+}
+
+func TestImportCliKeyFile(t *testing.T) {
+	v := cliKeyFileVectors[0]
+	node := newFakeNode(map[string]string{v.name: v.publicKey})
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+	fileName := filepath.Join("testdata", "wallet-cli", CliKeyFileName(v.name))
+
+	// a watch-only account becomes a signing one, its labels are kept
+	if err := w.AddWatchOnly(v.name, v.publicKey, "cold"); err != nil {
+		t.Fatal(err)
+	}
+	name, err := w.ImportCliKeyFile(fileName, v.passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := w.GetRecord(name)
+	if r == nil || r.WatchOnly || len(r.Labels) != 1 {
+		t.Fatalf("got record %+v", r)
+	}
+	if key, err := w.ExportPrivateKey(name); err != nil || key != v.privateKey {
+		t.Fatalf("got key %s, error %v", key, err)
+	}
+	// importing the same key again does nothing
+	if _, err := w.ImportCliKeyFile(fileName, v.passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	// an account with another key is not replaced
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	other, err := WriteCliKeyFile(dir, NewRecord("alice1", testKey2), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ImportCliKeyFile(other, "passphrase"); err != ErrAccountExists {
+		t.Fatalf("import over another key got %v", err)
+	}
+	if key, _ := w.ExportPrivateKey("alice1"); key != testKey {
+		t.Fatal("account is replaced by a key file")
+	}
+}
@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"fmt"
+	"github.com/coschain/cos-sdk-go/utils"
+	"sync"
+	"testing"
+)
+
+// run with -race, accounts are added, removed, read, locked and rotated at the same time
+func TestKeyStoreWalletConcurrency(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+	testConcurrency(t, w, node, func(stop <-chan struct{}) {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			w.Lock()
+			if err := w.Unlock("password", 0); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	if err := w.Unlock("password", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ResumeRotation("alice1", 0); err != nil && err != ErrNoRotation {
+		t.Fatal(err)
+	}
+	checkRotatedKey(t, w, node)
+}
+
+func TestMemWalletConcurrency(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := NewMemWallet(startNode(t, node), utils.Dev, WithOfflineImport())
+	defer w.Close()
+	testConcurrency(t, w, node, nil)
+	checkRotatedKey(t, w, node)
+	if n := node.trxCount(); n != 3 {
+		t.Fatalf("%d rotations broadcast, want 3", n)
+	}
+}
+
+type rotatingWallet interface {
+	Wallet
+	KeyRotator
+	Exporter
+}
+
+// rotate key of alice1 while other accounts are added and removed, and all accounts are read
+// lock is called in another goroutine if it's not nil, until stop is closed
+func testConcurrency(t *testing.T, w rotatingWallet, node *fakeNode, lock func(stop <-chan struct{})) {
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	var wg, readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			for j := 0; j < 20; j++ {
+				if err := w.Add(name, testKey2); err != nil && err != ErrWalletLocked {
+					t.Error(err)
+				}
+				if err := w.Remove(name); err != nil && err != ErrWalletLocked {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for name, acc := range w.GetAllAccounts() {
+				if acc.Name != name {
+					t.Errorf("account %s under name %s", acc.Name, name)
+				}
+			}
+			w.Account("alice1")
+			w.GetRecord("alice1")
+		}
+	}()
+	if lock != nil {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			lock(stop)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			_, err := w.RotateKey("alice1", nil)
+			if err == ErrRotationInProgress {
+				err = w.ResumeRotation("alice1", 0)
+			}
+			if err != nil && err != ErrWalletLocked {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+}
+
+// key of alice1 in wallet is the one on chain after rotations
+func checkRotatedKey(t *testing.T, w rotatingWallet, node *fakeNode) {
+	r := w.GetRecord("alice1")
+	if r == nil || r.Rotation != nil {
+		t.Fatalf("got record %+v", r)
+	}
+	if r.PublicKey != node.key("alice1") {
+		t.Fatalf("key in wallet %s, on chain %s", r.PublicKey, node.key("alice1"))
+	}
+	key, err := w.ExportPrivateKey("alice1")
+	if err != nil || NewRecord("alice1", key).PublicKey != r.PublicKey {
+		t.Fatalf("private key doesn't match public key %s, error %v", r.PublicKey, err)
+	}
+}
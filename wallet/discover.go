@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+)
+
+// BIP44 gap limit, scanning stops after this number of unused indexes in a row
+const DefaultGapLimit = 20
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+)
+
+// find the on-chain account controlled by a WIF private key, return nil if there is none
+func (w *BaseWallet) DiscoverAccount(privateKey string) (*Record, error) {
+	privKey, err := prototype.PrivateKeyFromWIF(privateKey)
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	pubKey, err := privKey.PubKey()
+	if err != nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	res, err := w.GetAccountByPubKey(pubKey.ToWIF())
+	if err != nil {
+		return nil, err
+	}
+	if res.Info == nil || res.Info.AccountName.GetValue() == "" {
+		return nil, nil
+	}
+	return NewRecord(res.Info.AccountName.GetValue(), privateKey), nil
+}
+
+// find on-chain accounts controlled by keys derived from a mnemonic
+// keys are derived by index from 0, until gapLimit indexes in a row control no account
+func (w *BaseWallet) DiscoverAccounts(mnemonic string, gapLimit int) ([]*Record, error) {
+	if !utils.IsValidMnemonic(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+	var records []*Record
+	for index, gap := uint32(0), 0; gap < gapLimit; index++ {
+		path := utils.HDPathByIndex(index)
+		_, pri, err := utils.GenerateKeyPairFromMnemonicWithPath(mnemonic, path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := w.DiscoverAccount(pri)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			gap++
+			continue
+		}
+		gap = 0
+		r.DerivationPath = path
+		r.Source = SourceMnemonic
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// import the on-chain account controlled by a private key under its name
+// return ErrAccountNotFound if the key controls no account
+func (w *BaseWallet) ImportByPrivateKey(privateKey string) (string, error) {
+	r, err := w.DiscoverAccount(privateKey)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		return "", ErrAccountNotFound
+	}
+	return r.Name, w.store.addRecord(r, true)
+}
+
+// import all on-chain accounts controlled by keys derived from a mnemonic, see DiscoverAccounts
+// return names of imported accounts, on error they are the ones imported before
+func (w *BaseWallet) ImportByMnemonic(mnemonic string, gapLimit int) ([]string, error) {
+	records, err := w.DiscoverAccounts(mnemonic, gapLimit)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, r := range records {
+		if err := w.store.addRecord(r, true); err != nil {
+			return names, err
+		}
+		names = append(names, r.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,83 @@
+package wallet
+
+import (
+	"github.com/coschain/cos-sdk-go/utils"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverAccount(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+
+	r, err := w.DiscoverAccount(testKey)
+	if err != nil || r == nil || r.Name != "alice1" || r.PrivateKey != testKey {
+		t.Fatalf("discovered %+v, error %v", r, err)
+	}
+	if r, err := w.DiscoverAccount(testKey2); err != nil || r != nil {
+		t.Fatalf("discovered %+v by a key without account, error %v", r, err)
+	}
+	if _, err := w.DiscoverAccount("bad key"); err != ErrInvalidPrivateKey {
+		t.Fatalf("invalid key got %v", err)
+	}
+
+	name, err := w.ImportByPrivateKey(testKey)
+	if err != nil || name != "alice1" {
+		t.Fatalf("imported %s, error %v", name, err)
+	}
+	if key, _ := w.ExportPrivateKey("alice1"); key != testKey {
+		t.Fatal("account is not imported")
+	}
+	if _, err := w.ImportByPrivateKey(testKey2); err != ErrAccountNotFound {
+		t.Fatalf("import a key without account got %v", err)
+	}
+}
+
+func TestDiscoverAccounts(t *testing.T) {
+	mnemonic, err := utils.GenerateNewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// accounts of keys at index 0 and 2, index 1 is unused
+	keys := make([]string, 3)
+	pubKeys := make(map[string]string)
+	for i, name := range []string{"alice1", "", "carol1"} {
+		pubKey, privKey, err := utils.GenerateKeyPairFromMnemonicWithPath(mnemonic, utils.HDPathByIndex(uint32(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = privKey
+		if name != "" {
+			pubKeys[name] = pubKey
+		}
+	}
+	node := newFakeNode(pubKeys)
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+
+	// scanning stops at the first unused index with gap limit 1
+	records, err := w.DiscoverAccounts(mnemonic, 1)
+	if err != nil || len(records) != 1 || records[0].Name != "alice1" {
+		t.Fatalf("discovered %v, error %v", records, err)
+	}
+	records, err = w.DiscoverAccounts(mnemonic, 0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("discovered %v, error %v", records, err)
+	}
+	for i, r := range records {
+		if r.Name != []string{"alice1", "carol1"}[i] || r.PrivateKey != keys[2*i] || r.Source != SourceMnemonic ||
+			r.DerivationPath != utils.HDPathByIndex(uint32(2*i)) {
+			t.Fatalf("discovered %+v", r)
+		}
+	}
+	if _, err := w.DiscoverAccounts("not a mnemonic", 0); err != ErrInvalidMnemonic {
+		t.Fatalf("invalid mnemonic got %v", err)
+	}
+
+	names, err := w.ImportByMnemonic(mnemonic, 0)
+	if err != nil || !reflect.DeepEqual(names, []string{"alice1", "carol1"}) {
+		t.Fatalf("imported %v, error %v", names, err)
+	}
+	if r := w.GetRecord("carol1"); r == nil || r.DerivationPath != utils.HDPathByIndex(2) {
+		t.Fatalf("got record %+v", r)
+	}
+}
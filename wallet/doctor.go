@@ -0,0 +1,172 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"sort"
+	"time"
+)
+
+// HealthStatus is the result of checking an account in wallet against the chain
+type HealthStatus int
+
+const (
+	// key in wallet controls the account on chain
+	HealthOK HealthStatus = iota
+	// private key in wallet is not a valid WIF key, or doesn't match the recorded public key
+	HealthInvalidKey
+	// account doesn't exist on chain
+	HealthNotFound
+	// account doesn't exist on chain, but the key controls another account, see OnChainName
+	HealthRenamed
+	// account exists, but its key on chain is not the key in wallet, e.g. the key is rotated elsewhere
+	HealthStaleKey
+	// chain can't be queried, see Err
+	HealthError
+	// key on chain is the one staged by a key rotation, call ResumeRotation to finish it
+	HealthRotationPending
+	// key on chain is in Record.ArchivedKeys, e.g. a rotation judged failed is applied later, add the key again to sign
+	HealthArchivedKey
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "ok"
+	case HealthInvalidKey:
+		return "invalid key"
+	case HealthNotFound:
+		return "not found"
+	case HealthRenamed:
+		return "renamed"
+	case HealthStaleKey:
+		return "stale key"
+	case HealthError:
+		return "error"
+	case HealthRotationPending:
+		return "rotation pending"
+	case HealthArchivedKey:
+		return "archived key"
+	}
+	return "unknown"
+}
+
+// AccountHealth is the check result of an account
+type AccountHealth struct {
+	Name        string
+	Status      HealthStatus
+	WatchOnly   bool
+	PublicKey   string // derived from private key, or recorded one if private key is not available
+	OnChainKey  string // set if account exists on chain
+	OnChainName string // set if HealthRenamed
+	Err         error  // set if HealthError
+}
+
+// HealthReport is the check result of all accounts in wallet
+type HealthReport struct {
+	CheckedTime int64            // unix seconds
+	Accounts    []*AccountHealth // sorted by name
+}
+
+// return true if all accounts are HealthOK
+func (r *HealthReport) Healthy() bool {
+	return len(r.Problems()) == 0
+}
+
+// return accounts not HealthOK
+func (r *HealthReport) Problems() []*AccountHealth {
+	var problems []*AccountHealth
+	for _, a := range r.Accounts {
+		if a.Status != HealthOK {
+			problems = append(problems, a)
+		}
+	}
+	return problems
+}
+
+// check every account in wallet against the chain, keys are validated and compared with the on-chain keys
+// it works with a locked keystore wallet, recorded public keys are checked instead of private keys
+// chain errors of an account are reported as HealthError, checking goes on with other accounts
+func (w *BaseWallet) Doctor() (*HealthReport, error) {
+	w.dataMu.RLock()
+	if w.records == nil {
+		w.dataMu.RUnlock()
+		return nil, ErrWalletClosed
+	}
+	records := make([]*Record, 0, len(w.accounts))
+	for name := range w.accounts {
+		if r, ok := w.records[name]; ok {
+			records = append(records, r.Copy())
+		}
+	}
+	w.dataMu.RUnlock()
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+
+	report := &HealthReport{CheckedTime: time.Now().Unix()}
+	for _, r := range records {
+		report.Accounts = append(report.Accounts, w.checkRecord(r))
+	}
+	return report, nil
+}
+
+func (w *BaseWallet) checkRecord(r *Record) *AccountHealth {
+	h := &AccountHealth{Name: r.Name, WatchOnly: r.WatchOnly, PublicKey: r.PublicKey}
+	if r.PrivateKey != "" {
+		privKey, err := prototype.PrivateKeyFromWIF(r.PrivateKey)
+		if err != nil {
+			h.Status = HealthInvalidKey
+			return h
+		}
+		pubKey, err := privKey.PubKey()
+		if err != nil || (r.PublicKey != "" && pubKey.ToWIF() != r.PublicKey) {
+			h.Status = HealthInvalidKey
+			return h
+		}
+		h.PublicKey = pubKey.ToWIF()
+	}
+	var pubKey *prototype.PublicKeyType
+	if h.PublicKey != "" {
+		k, err := prototype.PublicKeyFromWIF(h.PublicKey)
+		if err != nil {
+			h.Status = HealthInvalidKey
+			return h
+		}
+		pubKey = k
+	}
+
+	res, err := w.GetAccountByName(r.Name)
+	if err != nil {
+		h.Status, h.Err = HealthError, err
+		return h
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		h.Status = HealthNotFound
+		if pubKey == nil {
+			return h
+		}
+		res, err := w.GetAccountByPubKey(h.PublicKey)
+		if err != nil {
+			h.Status, h.Err = HealthError, err
+			return h
+		}
+		if name := res.Info.GetAccountName().GetValue(); name != "" && name != r.Name {
+			h.Status, h.OnChainName = HealthRenamed, name
+		}
+		return h
+	}
+	h.OnChainKey = res.Info.PublicKey.ToWIF()
+	// a watch-only account with no recorded key only needs to exist
+	if pubKey != nil && !res.Info.PublicKey.Equal(pubKey) {
+		h.Status = HealthStaleKey
+		if r.Rotation != nil && r.Rotation.PublicKey == h.OnChainKey {
+			h.Status = HealthRotationPending
+		}
+		for _, k := range r.ArchivedKeys {
+			if k.PublicKey == h.OnChainKey {
+				h.Status = HealthArchivedKey
+			}
+		}
+	}
+	return h
+}
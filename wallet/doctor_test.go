@@ -0,0 +1,81 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey, "bobby1": testPubKey, "dave01": testPubKey2, "erin01": testPubKey})
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+	for name, key := range map[string]string{"alice1": testKey, "bobby1": testKey2, "carol1": testKey2} {
+		if err := w.Add(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddWatchOnly("erin01", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddWatchOnly("frank1", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []AccountHealth{
+		{Name: "alice1", Status: HealthOK, PublicKey: testPubKey, OnChainKey: testPubKey},
+		{Name: "bobby1", Status: HealthStaleKey, PublicKey: testPubKey2, OnChainKey: testPubKey},
+		{Name: "carol1", Status: HealthRenamed, PublicKey: testPubKey2, OnChainName: "dave01"},
+		{Name: "erin01", Status: HealthOK, WatchOnly: true, OnChainKey: testPubKey},
+		{Name: "frank1", Status: HealthNotFound, WatchOnly: true},
+	}
+
+	// a locked wallet is checked by recorded public keys
+	for _, locked := range []bool{false, true} {
+		if locked {
+			w.Lock()
+		}
+		report, err := w.Doctor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Accounts) != len(want) {
+			t.Fatalf("locked %v: got %d accounts", locked, len(report.Accounts))
+		}
+		for i, h := range report.Accounts {
+			if !reflect.DeepEqual(*h, want[i]) {
+				t.Fatalf("locked %v: got %+v, want %+v", locked, *h, want[i])
+			}
+		}
+		if report.Healthy() {
+			t.Fatalf("locked %v: report is healthy", locked)
+		}
+		var problems []string
+		for _, h := range report.Problems() {
+			problems = append(problems, h.Name)
+		}
+		if !reflect.DeepEqual(problems, []string{"bobby1", "carol1", "frank1"}) {
+			t.Fatalf("locked %v: got problems %v", locked, problems)
+		}
+	}
+}
+
+func TestDoctorInvalidKey(t *testing.T) {
+	w := newTestKeyStoreWallet(t, "127.0.0.1:1")
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	// a key which doesn't match the recorded public key
+	w.dataMu.Lock()
+	w.records["alice1"].PublicKey = testPubKey2
+	w.dataMu.Unlock()
+	report, err := w.Doctor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := report.Accounts[0]; h.Status != HealthInvalidKey || h.Status.String() != "invalid key" {
+		t.Fatalf("got %+v", h)
+	}
+
+	w.Close()
+	if _, err := w.Doctor(); err != ErrWalletClosed {
+		t.Fatalf("check a closed wallet got %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package wallet
+
+// file locking is not supported on this platform, external modifications are still merged on save
+type fileLock struct{}
+
+func lockFile(fileName string) (*fileLock, error) {
+	return &fileLock{}, nil
+}
+
+func (l *fileLock) release() error {
+	return nil
+}
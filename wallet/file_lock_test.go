@@ -0,0 +1,51 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd windows
+
+package wallet
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyStoreFileLocked(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.key")
+	w, err := openTestFile(t, fileName, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.LockFileName() != fileName+".lock" {
+		t.Fatalf("got lock file %s", w.LockFileName())
+	}
+	if _, err := openTestFile(t, fileName, "password"); err != ErrKeyStoreLocked {
+		t.Fatalf("open a locked keystore got %v", err)
+	}
+
+	// the lock is released by Close, and a wallet opening the file again takes it
+	w.Close()
+	if w.LockFileName() != "" {
+		t.Fatal("lock file is kept after closed")
+	}
+	if _, err := openTestFile(t, fileName, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Open(fileName, "password"); err != ErrKeyStoreLocked {
+		t.Fatalf("open a locked keystore got %v", err)
+	}
+}
+
+func TestDirStorageLocked(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keystore")
+	s, err := NewDirStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDirStorage(dir); err != ErrKeyStoreLocked {
+		t.Fatalf("open a locked storage got %v", err)
+	}
+	s.Close()
+	s, err = NewDirStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
@@ -0,0 +1,34 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package wallet
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock is an advisory lock, it's released automatically if process exits
+type fileLock struct {
+	f *os.File
+}
+
+// acquire an exclusive lock on file name, fail immediately if held by others
+func lockFile(fileName string) (*fileLock, error) {
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrKeyStoreLocked
+		}
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) release() error {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
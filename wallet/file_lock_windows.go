@@ -0,0 +1,36 @@
+// +build windows
+
+package wallet
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock is a handle opened without sharing, it's released automatically if process exits
+type fileLock struct {
+	h syscall.Handle
+}
+
+const errSharingViolation syscall.Errno = 32
+
+// acquire an exclusive lock on file name, fail immediately if held by others
+func lockFile(fileName string) (*fileLock, error) {
+	name, err := syscall.UTF16PtrFromString(fileName)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errSharingViolation {
+			return nil, ErrKeyStoreLocked
+		}
+		return nil, &os.PathError{Op: "lock", Path: fileName, Err: err}
+	}
+	return &fileLock{h: h}, nil
+}
+
+func (l *fileLock) release() error {
+	return syscall.CloseHandle(l.h)
+}
@@ -0,0 +1,78 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// write data to a temp file in the same directory, then rename it to file name
+// the file either keeps old content or has the complete new content, even if process crashes
+func writeFileAtomic(fileName string, data []byte, perm os.FileMode) error {
+	return writeFile(fileName, data, perm, true)
+}
+
+// same as writeFileAtomic, but an existing file is never replaced, the error satisfies os.IsExist then
+// the temp file is hard linked to file name, so there is no window between checking and creating the file
+func writeFileExclusive(fileName string, data []byte, perm os.FileMode) error {
+	return writeFile(fileName, data, perm, false)
+}
+
+func writeFile(fileName string, data []byte, perm os.FileMode, replace bool) error {
+	dir, base := filepath.Split(fileName)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after successful rename, only the temp name is removed after link
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if replace {
+		err = os.Rename(tmpName, fileName)
+	} else {
+		err = os.Link(tmpName, fileName)
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// make a rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// some platforms don't support syncing a directory, it's best effort
+	d.Sync()
+	return nil
+}
+
+// copy a file atomically
+func copyFile(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data, 0600)
+}
@@ -0,0 +1,50 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// only the file is left in dir, temp files are removed
+func checkOnlyFile(t *testing.T, fileName string) {
+	files, err := ioutil.ReadDir(filepath.Dir(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != filepath.Base(fileName) {
+		t.Fatalf("got files %v", files)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.key")
+	for _, content := range []string{"old content", "new"} {
+		if err := writeFileAtomic(fileName, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil || string(data) != content {
+			t.Fatalf("got %q, error %v", data, err)
+		}
+		checkOnlyFile(t, fileName)
+	}
+	if info, err := os.Stat(fileName); err != nil || (os.PathSeparator == '/' && info.Mode().Perm() != 0600) {
+		t.Fatalf("got file %v, error %v", info, err)
+	}
+}
+
+func TestWriteFileExclusive(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.key")
+	if err := writeFileExclusive(fileName, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileExclusive(fileName, []byte("second"), 0600); !os.IsExist(err) {
+		t.Fatalf("write over an existing file got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(fileName); string(data) != "first" {
+		t.Fatalf("got %q, an existing file is replaced", data)
+	}
+	checkOnlyFile(t, fileName)
+}
@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/utils"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keys of accounts in tests
+const (
+	testKey     = "3sYZkeNuv3nD1karW9CJb57LxRzAEv5sXHMM28UecrMF5Jruep"
+	testPubKey  = "COS7DdKA93USv1zhnoxVMukiE6WfaRbZChpLfAwPkPneTtwN2eW1T"
+	testKey2    = "43GMm2QXbu7GGg721QbfCPuyY1kDUnPjTDmK5TytnU6c85aGkY"
+	testPubKey2 = "COS88YMwYe8h6dHVvQEyYXgycFhjXP7TWHVzkqhSpdEBWGVKGCm73"
+)
+
+// fakeNode answers the queries and broadcasts of wallets, keys of accounts are changed by AccountUpdate
+type fakeNode struct {
+	grpcpb.UnimplementedApiServiceServer
+
+	mu   sync.Mutex
+	keys map[string]string // account name -> WIF public key
+	// status of broadcast transactions, prototype.StatusSuccess if 0
+	status uint32
+	trxs   []*prototype.SignedTransaction
+}
+
+func newFakeNode(keys map[string]string) *fakeNode {
+	f := &fakeNode{keys: make(map[string]string)}
+	for name, key := range keys {
+		f.keys[name] = key
+	}
+	return f
+}
+
+// start a grpc server of f, and connect wallets to it
+func startNode(t *testing.T, f *fakeNode) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	grpcpb.RegisterApiServiceServer(s, f)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return l.Addr().String()
+}
+
+func (f *fakeNode) key(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.keys[name]
+}
+
+func (f *fakeNode) setStatus(status uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeNode) trxCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.trxs)
+}
+
+func (f *fakeNode) GetAccountByName(ctx context.Context, req *grpcpb.GetAccountByNameRequest) (*grpcpb.AccountResponse, error) {
+	key := f.key(req.AccountName.Value)
+	if key == "" {
+		return &grpcpb.AccountResponse{}, nil
+	}
+	pubKey, err := prototype.PublicKeyFromWIF(key)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcpb.AccountResponse{Info: &grpcpb.AccountInfo{AccountName: req.AccountName, PublicKey: pubKey}}, nil
+}
+
+func (f *fakeNode) GetAccountByPubKey(ctx context.Context, req *grpcpb.GetAccountByPubKeyRequest) (*grpcpb.AccountResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, key := range f.keys {
+		if key == req.PublicKey {
+			return &grpcpb.AccountResponse{Info: &grpcpb.AccountInfo{AccountName: &prototype.AccountName{Value: name}}}, nil
+		}
+	}
+	return &grpcpb.AccountResponse{Info: &grpcpb.AccountInfo{}}, nil
+}
+
+func (f *fakeNode) GetChainState(ctx context.Context, req *grpcpb.NonParamsRequest) (*grpcpb.GetChainStateResponse, error) {
+	return &grpcpb.GetChainStateResponse{State: &grpcpb.ChainState{Dgpo: &prototype.DynamicProperties{
+		HeadBlockId:     &prototype.Sha256{Hash: make([]byte, 32)},
+		HeadBlockNumber: 1,
+		Time:            &prototype.TimePointSec{UtcSeconds: uint32(time.Now().Unix())},
+	}}}, nil
+}
+
+// every transaction is applied at once and irreversible, unless f.status is set
+func (f *fakeNode) BroadcastTrx(ctx context.Context, req *grpcpb.BroadcastTrxRequest) (*grpcpb.BroadcastTrxResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trxs = append(f.trxs, req.Transaction)
+	status := f.status
+	if status == 0 {
+		status = prototype.StatusSuccess
+		for _, op := range req.Transaction.Trx.Operations {
+			if update, ok := prototype.GetBaseOperation(op).(*prototype.AccountUpdateOperation); ok {
+				f.keys[update.Owner.Value] = update.PubKey.ToWIF()
+			}
+		}
+	}
+	return &grpcpb.BroadcastTrxResponse{Invoice: &prototype.TransactionReceiptWithInfo{Status: status}}, nil
+}
+
+func (f *fakeNode) GetBlkIsIrreversibleByTxId(ctx context.Context, req *grpcpb.GetBlkIsIrreversibleByTxIdRequest) (*grpcpb.GetBlkIsIrreversibleByTxIdResponse, error) {
+	return &grpcpb.GetBlkIsIrreversibleByTxIdResponse{Result: true}, nil
+}
+
+// a keystore wallet on a memory storage with cheap kdf parameters, keys are not checked against the chain
+func newTestKeyStoreWallet(t *testing.T, ip string) *KeyStoreWallet {
+	w := NewKeyStoreWallet(ip, utils.Dev, WithOfflineImport())
+	w.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+	if err := w.OpenStorage(NewMemStorage(), "password"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// open a keystore in s, keys are not checked against the chain
+func openTestStorage(t *testing.T, s Storage) (*KeyStoreWallet, error) {
+	w := NewKeyStoreWallet("127.0.0.1:1", utils.Dev, WithOfflineImport())
+	w.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+	err := w.OpenStorage(s, "password")
+	t.Cleanup(func() { w.Close() })
+	return w, err
+}
+
+// open a keystore file with cheap kdf parameters, keys are not checked against the chain
+func openTestFile(t *testing.T, fileName, password string) (*KeyStoreWallet, error) {
+	w := NewKeyStoreWallet("127.0.0.1:1", utils.Dev, WithOfflineImport())
+	w.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+	err := w.Open(fileName, password)
+	t.Cleanup(func() { w.Close() })
+	return w, err
+}
+
+// a storage saving entries one by one, Save, SaveHeader or Delete fails if set
+type failingStorage struct {
+	*DirStorage
+	failSave, failHeader, failDelete bool
+}
+
+func (s *failingStorage) Save(name string, data []byte) error {
+	if s.failSave {
+		return errors.New("entry not saved")
+	}
+	return s.DirStorage.Save(name, data)
+}
+
+func (s *failingStorage) SaveHeader(header []byte) error {
+	if s.failHeader {
+		return errors.New("header not saved")
+	}
+	return s.DirStorage.SaveHeader(header)
+}
+
+func (s *failingStorage) Delete(name string) error {
+	if s.failDelete {
+		return errors.New("entry not deleted")
+	}
+	return s.DirStorage.Delete(name)
+}
+
+// check w has the accounts of keystores in testdata
+func checkTestAccounts(t *testing.T, w *KeyStoreWallet) {
+	keys := map[string]string{"alice1": testKey, "bobby1": testKey2}
+	if n := len(w.GetAllAccounts()); n != len(keys) {
+		t.Fatalf("%d accounts in wallet, want %d", n, len(keys))
+	}
+	for name, key := range keys {
+		if w.Account(name) == nil {
+			t.Fatalf("account %s not in wallet", name)
+		}
+		if got, err := w.ExportPrivateKey(name); err != nil || got != key {
+			t.Fatalf("account %s has key %s, error %v", name, got, err)
+		}
+	}
+}
+
+// parse a keystore file written by FileStorage
+func readKeyStoreFile(t *testing.T, fileName string, f *keyStoreFile) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		t.Fatal(err)
+	}
+}
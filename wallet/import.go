@@ -0,0 +1,84 @@
+package wallet
+
+import (
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/kataras/go-errors"
+)
+
+var (
+	ErrInvalidPrivateKey = errors.New("invalid WIF private key")
+	ErrAccountNotFound   = errors.New("account not found on chain")
+)
+
+// KeyMismatchError is returned when an imported key doesn't control the account on chain
+type KeyMismatchError struct {
+	Name       string
+	OnChainKey string
+	Key        string // public key of the imported private key
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("key doesn't match account %s, on-chain key: %s, imported key: %s", e.Name, e.OnChainKey, e.Key)
+}
+
+// Option configures a wallet when it's created
+type Option func(w *BaseWallet)
+
+// imported keys are only checked to be valid, but not against the chain
+// it's needed to import accounts without a node, or accounts not created yet. by default both wallets check the chain
+func WithOfflineImport() Option {
+	return func(w *BaseWallet) {
+		w.offlineImport = true
+	}
+}
+
+// merge r with old, the record of the same account already in wallet or nil, return whether r should be saved
+// metadata, policy, staged and archived keys of old are kept. if replace is false, old is kept unless it's watch-only with the same
+// public key or none, adding the same key again does nothing, and ErrAccountExists is returned otherwise
+func mergeRecord(r, old *Record, replace bool) (bool, error) {
+	if old == nil {
+		return true, nil
+	}
+	upgrade := old.WatchOnly && (old.PublicKey == "" || old.PublicKey == r.PublicKey)
+	if !replace && !upgrade {
+		if old.WatchOnly || old.PrivateKey != r.PrivateKey {
+			return false, ErrAccountExists
+		}
+		return false, nil
+	}
+	keepMetadata(r, old)
+	keepPolicy(r, old)
+	keepRotation(r, old)
+	return true, nil
+}
+
+// check a WIF private key is valid and is the current key of account name on chain
+// return ErrInvalidPrivateKey, ErrAccountNotFound or *KeyMismatchError
+// the chain check is skipped if the wallet imports offline, see WithOfflineImport
+func (w *BaseWallet) ValidateKey(name, privateKey string) error {
+	privKey, err := prototype.PrivateKeyFromWIF(privateKey)
+	if err != nil {
+		return ErrInvalidPrivateKey
+	}
+	pubKey, err := privKey.PubKey()
+	if err != nil {
+		return ErrInvalidPrivateKey
+	}
+
+	if w.offlineImport {
+		return nil
+	}
+
+	res, err := w.GetAccountByName(name)
+	if err != nil {
+		return err
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		return ErrAccountNotFound
+	}
+	if !res.Info.PublicKey.Equal(pubKey) {
+		return &KeyMismatchError{Name: name, OnChainKey: res.Info.PublicKey.ToWIF(), Key: pubKey.ToWIF()}
+	}
+	return nil
+}
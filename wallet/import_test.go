@@ -0,0 +1,53 @@
+package wallet
+
+import (
+	"errors"
+	"github.com/coschain/cos-sdk-go/utils"
+	"testing"
+)
+
+// both wallets check keys against the chain by default
+func TestAddChecksChain(t *testing.T) {
+	ip := startNode(t, newFakeNode(map[string]string{"alice1": testPubKey}))
+	ks := NewKeyStoreWallet(ip, utils.Dev)
+	ks.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+	if err := ks.OpenStorage(NewMemStorage(), "password"); err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+	mem := NewMemWallet(ip, utils.Dev)
+	defer mem.Close()
+
+	for _, w := range []Wallet{ks, mem} {
+		if err := w.Add("alice1", "invalid"); !errors.Is(err, ErrInvalidPrivateKey) {
+			t.Fatalf("%T: invalid key got %v", w, err)
+		}
+		if err := w.Add("bobby1", testKey2); !errors.Is(err, ErrAccountNotFound) {
+			t.Fatalf("%T: account not on chain got %v", w, err)
+		}
+		var mismatch *KeyMismatchError
+		if err := w.Add("alice1", testKey2); !errors.As(err, &mismatch) {
+			t.Fatalf("%T: another key got %v", w, err)
+		}
+		if mismatch.Name != "alice1" || mismatch.OnChainKey != testPubKey || mismatch.Key != testPubKey2 {
+			t.Fatalf("%T: got error %+v", w, mismatch)
+		}
+		if n := len(w.GetAllAccounts()); n != 0 {
+			t.Fatalf("%T: %d accounts added", w, n)
+		}
+		if err := w.Add("alice1", testKey); err != nil {
+			t.Fatalf("%T: %v", w, err)
+		}
+	}
+}
+
+func TestOfflineImport(t *testing.T) {
+	w := NewMemWallet(startNode(t, newFakeNode(nil)), utils.Dev, WithOfflineImport())
+	defer w.Close()
+	if err := w.Add("bobby1", testKey2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("carol1", "invalid"); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Fatalf("invalid key got %v", err)
+	}
+}
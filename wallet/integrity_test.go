@@ -0,0 +1,109 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// change the header of a keystore file by f
+func tamperHeader(t *testing.T, fileName string, f func(eks *EncryptKeyStore)) {
+	var file keyStoreFile
+	readKeyStoreFile(t, fileName, &file)
+	var eks EncryptKeyStore
+	if err := json.Unmarshal(file.Header, &eks); err != nil {
+		t.Fatal(err)
+	}
+	f(&eks)
+	header, err := json.Marshal(&eks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Header = header
+	writeKeyStoreFile(t, fileName, &file)
+}
+
+func writeKeyStoreFile(t *testing.T, fileName string, f *keyStoreFile) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fileName, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flip a bit of base64 encoded data
+func flipBase64(t *testing.T, s string) string {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 1
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// a modified keystore is reported as corrupted, not as a wrong password
+func TestKeyStoreTampered(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "test.key")
+	w, err := openTestFile(t, fileName, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	original, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openTestFile(t, fileName, "wrong"); err != ErrWrongPassword {
+		t.Fatalf("wrong password got %v", err)
+	}
+
+	tampers := map[string]func(eks *EncryptKeyStore){
+		"cipher text": func(eks *EncryptKeyStore) { eks.CipherText = flipBase64(t, eks.CipherText) },
+		"nonce":       func(eks *EncryptKeyStore) { eks.Iv = flipBase64(t, eks.Iv) },
+		"version":     func(eks *EncryptKeyStore) { eks.Version = KeyStoreVersionAEAD },
+		"kdf":         func(eks *EncryptKeyStore) { eks.Kdf = "" },
+		"salt":        func(eks *EncryptKeyStore) { eks.Salt = "not base64" },
+	}
+	for name, tamper := range tampers {
+		if err := ioutil.WriteFile(fileName, original, 0600); err != nil {
+			t.Fatal(err)
+		}
+		tamperHeader(t, fileName, tamper)
+		if _, err := openTestFile(t, fileName, "password"); err != ErrKeyStoreCorrupted {
+			t.Fatalf("changed %s got %v", name, err)
+		}
+	}
+
+	// a changed entry is damaged, other accounts are still usable
+	if err := ioutil.WriteFile(fileName, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	var file keyStoreFile
+	readKeyStoreFile(t, fileName, &file)
+	file.Records["alice1"][len(file.Records["alice1"])-1] ^= 1
+	writeKeyStoreFile(t, fileName, &file)
+	var derr *DamagedRecordsError
+	w, err = openTestFile(t, fileName, "password")
+	if !errors.As(err, &derr) || !reflect.DeepEqual(derr.Names, []string{"alice1"}) {
+		t.Fatalf("changed entry got %v", err)
+	}
+	w.Close()
+
+	if err := ioutil.WriteFile(fileName, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openTestFile(t, fileName, "password"); err != ErrKeyStoreCorrupted {
+		t.Fatalf("truncated file got %v", err)
+	}
+}
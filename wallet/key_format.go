@@ -0,0 +1,67 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+)
+
+// return a record of a private key in raw hex, e.g. exported from an ethereum wallet
+func RecordFromHexKey(name, hexKey string) (*Record, error) {
+	privKey, err := utils.PrivateKeyFromHex(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	return newRecordOf(name, privKey, SourceHexKey), nil
+}
+
+// return a record of a secp256k1 private key in PEM, SEC 1 or unencrypted PKCS #8, e.g. made by openssl
+func RecordFromPEM(name string, pemData []byte) (*Record, error) {
+	privKey, err := utils.PrivateKeyFromPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return newRecordOf(name, privKey, SourcePEM), nil
+}
+
+// return a record of a private key in an ethereum keystore v3 json file, e.g. made by geth or MetaMask
+// return ErrWrongPassword if passphrase is incorrect
+func RecordFromEthKeyStore(name string, keyJson []byte, passphrase string) (*Record, error) {
+	privKey, err := utils.PrivateKeyFromEthKeyStore(keyJson, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newRecordOf(name, privKey, SourceEthKeyStore), nil
+}
+
+func newRecordOf(name string, privKey *prototype.PrivateKeyType, source string) *Record {
+	r := NewRecord(name, privKey.ToWIF())
+	r.Source = source
+	return r
+}
+
+// add an account by a private key in raw hex, with or without 0x prefix
+func (w *BaseWallet) AddByHexKey(name, hexKey string) error {
+	r, err := RecordFromHexKey(name, hexKey)
+	if err != nil {
+		return err
+	}
+	return w.store.addRecord(r, true)
+}
+
+// add an account by a secp256k1 private key in PEM, see RecordFromPEM
+func (w *BaseWallet) AddByPEM(name string, pemData []byte) error {
+	r, err := RecordFromPEM(name, pemData)
+	if err != nil {
+		return err
+	}
+	return w.store.addRecord(r, true)
+}
+
+// add an account by an ethereum keystore v3 json file, see RecordFromEthKeyStore
+func (w *BaseWallet) AddByEthKeyStore(name string, keyJson []byte, passphrase string) error {
+	r, err := RecordFromEthKeyStore(name, keyJson, passphrase)
+	if err != nil {
+		return err
+	}
+	return w.store.addRecord(r, true)
+}
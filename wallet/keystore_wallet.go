@@ -4,66 +4,314 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/gob"
 	"encoding/json"
+	"fmt"
 	"github.com/coschain/cos-sdk-go/account"
 	"github.com/coschain/cos-sdk-go/rpcclient"
 	"github.com/coschain/cos-sdk-go/utils"
 	"github.com/kataras/go-errors"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	errNotOpen = errors.New("shoud call Open and specify key store file path firstly")
+
+	// same error as utils.ErrWrongPassword, so it's one sentinel whichever package decrypts
+	ErrWrongPassword = utils.ErrWrongPassword
+	ErrKeyStoreCorrupted = errors.New("keystore file is corrupted or modified")
+	ErrKeyStoreLocked = errors.New("keystore file is opened by another wallet")
+	ErrWalletLocked = errors.New("wallet is locked, call Unlock first")
+	ErrAccountExists = errors.New("account already in wallet with a different key")
+	ErrWalletClosed = errors.New("wallet is closed")
 )
 
+const (
+	// legacy format, aes key is sha256 of password
+	KeyStoreVersionLegacy = 0
+	// aes key is derived from password by scrypt with a random salt
+	KeyStoreVersionScrypt = 1
+	// payload is encrypted by aes-gcm, all other fields are authenticated as associated data
+	KeyStoreVersionAEAD = 2
+	// payload is a json encoded KeyStoreContent instead of gob encoded accounts
+	KeyStoreVersionJSON = 3
+	// payload is a random data key, each account is encrypted by it separately and kept in a Storage
+	KeyStoreVersionStorage = 4
+
+	CurrentKeyStoreVersion = KeyStoreVersionStorage
+)
+
+// mac of this message tells whether password is correct, independent of the cipher text
+const passwordCheckMessage = "cos-sdk-go keystore password check"
+
 type EncryptKeyStore struct {
-	CipherText string // encrypted privkey
-	Iv         string // the iv
-	Mac        string // the mac of passphrase
+	Version    int              `json:",omitempty"` // missing in legacy files
+	CipherText string           // encrypted privkey, or the data key since version 4
+	Iv         string           // the iv, or the gcm nonce since version 2
+	Mac        string           // the mac of passphrase, or of cipher text in version 1
+	Kdf        string           `json:",omitempty"`
+	KdfParams  *utils.KdfParams `json:",omitempty"`
+	Salt       string           `json:",omitempty"`
+}
+
+// keyStoreKeys is the payload of a keystore header since version 4
+// the manifest is authenticated along with the data key, so a deleted or rolled back entry is detected
+type keyStoreKeys struct {
+	DataKey []byte `json:"data_key"`
+	// data key before password is changed, kept until every entry is sealed with DataKey, see ChangePassword
+	PrevDataKey []byte `json:"prev_data_key,omitempty"`
+	// sequence number of the last write
+	Counter uint64 `json:"counter"`
+	// sequence number of each entry in storage by name
+	Manifest map[string]uint64 `json:"manifest"`
+}
+
+// DamagedRecordsError is returned when a keystore is opened, unlocked or reloaded with entries which can't be used,
+// they can't be decrypted, are missing from storage, or are older than the header lists, e.g. rolled back.
+// the wallet is open with other accounts and contacts meanwhile, check it with errors.As, see DamagedRecords
+type DamagedRecordsError struct {
+	Names []string // sorted, contacts are named "#contact/<name>"
+}
+
+func (e *DamagedRecordsError) Error() string {
+	return fmt.Sprintf("damaged records in keystore: %s", strings.Join(e.Names, ", "))
+}
+
+// return everything except cipher text and nonce, which is authenticated along with the payload
+// the nonce needs no authentication, payload can't be decrypted with a modified one
+func (eks *EncryptKeyStore) header() ([]byte, error) {
+	h := *eks
+	h.CipherText = ""
+	h.Iv = ""
+	return json.Marshal(&h)
 }
 
 type KeyStoreWallet struct {
 	BaseWallet
 
-	password string
-	fullFileName string
+	password []byte
+	storage Storage
+	// sha256 of the header loaded or saved last, to detect changes by other tools
+	headerSum []byte
+
+	// guards storage, keys and lock state, which is also changed by auto-lock timer
+	// it's always acquired before dataMu
+	mu sync.Mutex
+	locked bool
+	lockTimer *time.Timer
+
+	kdfParams utils.KdfParams
+	// derived keys are cached, so saving won't run the kdf every time
+	salt []byte
+	encKey []byte
+	macKey []byte
+	// random key encrypting records, it's encrypted by the derived key in header
+	dataKey []byte
+	// data key before password is changed, set until every entry is sealed with dataKey
+	prevDataKey []byte
+	// sequence number of the last write, and of each entry in storage, they are saved in header
+	counter  uint64
+	manifest map[string]uint64
+	// names of entries in storage which can't be decrypted, see DamagedRecords
+	damaged map[string]bool
 }
 
-func NewKeyStoreWallet(ip string, chainId utils.ChainId) *KeyStoreWallet {
+// create a wallet keeping accounts in a keystore, imported keys are checked against the chain
+// unless opts has WithOfflineImport()
+func NewKeyStoreWallet(ip string, chainId utils.ChainId, opts ...Option) *KeyStoreWallet {
 	if err := rpcclient.ConnectRpc(ip); err != nil {
 		return nil
 	}
 	w := &KeyStoreWallet{}
 	w.accounts = make(map[string]*account.Account)
+	w.records = make(map[string]*Record)
+	w.contacts = make(map[string]*Contact)
 	w.chainId = chainId
+	w.kdfParams = utils.DefaultKdfParams
+	w.store = w
+	for _, opt := range opts {
+		opt(&w.BaseWallet)
+	}
 	return w
 }
 
+// set scrypt parameters for next save, the keystore header is re-encrypted with a new salt
+func (w *KeyStoreWallet) SetKdfParams(params utils.KdfParams) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.kdfParams = params
+	w.resetKey()
+}
+
+// open a keystore file, an advisory lock is held until Close, so it can't be opened by other wallets
+// the wallet is unlocked after opened, and never locks automatically until Unlock is called with a duration
+// if some records can't be used, the wallet is open with others, and a *DamagedRecordsError is returned
 func (w *KeyStoreWallet) Open(pathToFile, password string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	w.fullFileName = pathToFile
-	w.password = password
+	w.closeStorage()
+	s, err := NewFileStorage(pathToFile)
+	if err != nil {
+		return err
+	}
+	return w.open(s, password)
+}
 
-	if _, err := os.Stat(pathToFile); os.IsNotExist(err) {
-		return w.save()
-	} else {
-		return w.load()
+// open a keystore kept in a storage, the storage is closed by Close of wallet
+func (w *KeyStoreWallet) OpenStorage(s Storage, password string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closeStorage()
+	return w.open(s, password)
+}
+
+// caller must hold w.mu
+func (w *KeyStoreWallet) open(s Storage, password string) error {
+	w.storage = s
+	w.password = []byte(password)
+	err := w.load()
+	if err != nil && !isDamaged(err) {
+		w.closeStorage()
+		return err
+	}
+	w.locked = false
+	return err
+}
+
+func (w *KeyStoreWallet) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.closeStorage()
+	w.setRecords(nil)
+	w.setContacts(nil)
+	return err
+}
+
+// caller must hold w.mu
+func (w *KeyStoreWallet) closeStorage() error {
+	w.lockKeys()
+	if w.storage == nil {
+		return nil
 	}
+	err := w.storage.Close()
+	w.storage = nil
+	return err
 }
 
-func (w *KeyStoreWallet) Close() {
-	w.accounts = nil
+// forget password and private keys, accounts are still listed but can't sign until unlocked
+func (w *KeyStoreWallet) Lock() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lockKeys()
+}
+
+// decrypt keystore again with password
+// if timeout > 0, wallet is locked automatically after timeout
+// a *DamagedRecordsError is returned after unlocked if some records can't be used
+func (w *KeyStoreWallet) Unlock(password string, timeout time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.storage == nil {
+		return errNotOpen
+	}
+	// damaged records don't stop the wallet from being unlocked
+	var err error
+	if w.locked {
+		w.password = []byte(password)
+		if err = w.load(); err != nil && !isDamaged(err) {
+			w.lockKeys()
+			return err
+		}
+		w.locked = false
+	} else if subtle.ConstantTimeCompare([]byte(password), w.password) != 1 {
+		return ErrWrongPassword
+	}
+
+	if w.lockTimer != nil {
+		w.lockTimer.Stop()
+		w.lockTimer = nil
+	}
+	if timeout > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(timeout, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			// a timer which fired before it's stopped is stale, e.g. Unlock is called again meanwhile
+			if w.lockTimer == timer {
+				w.lockKeys()
+			}
+		})
+		w.lockTimer = timer
+	}
+	return err
+}
+
+// check if wallet is locked
+func (w *KeyStoreWallet) IsLocked() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.locked
+}
+
+// clear key material in memory, caller must hold w.mu
+func (w *KeyStoreWallet) lockKeys() {
+	if w.lockTimer != nil {
+		w.lockTimer.Stop()
+		w.lockTimer = nil
+	}
+	utils.ZeroBytes(w.password)
+	w.password = nil
+	w.resetKey()
+	utils.ZeroBytes(w.dataKey)
+	utils.ZeroBytes(w.prevDataKey)
+	w.dataKey, w.prevDataKey = nil, nil
+	w.dataMu.Lock()
+	for _, r := range w.records {
+		r.clearPrivateKeys()
+	}
+	w.dataMu.Unlock()
+	w.locked = true
+}
+
+// return private key of an account for signing
+func (w *KeyStoreWallet) privateKey(name string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r, ok := w.records[name]
+	if ok && r.WatchOnly {
+		return "", ErrWatchOnly
+	}
+	if w.locked {
+		return "", ErrWalletLocked
+	}
+	if !ok {
+		return "", errors.New("account not in wallet: " + name)
+	}
+	return r.PrivateKey, nil
+}
+
+// return the file name of the advisory lock held by the storage
+// empty if the storage has no lock file, e.g. a MemStorage or LevelDBStorage given to OpenStorage, or it's closed
+func (w *KeyStoreWallet) LockFileName() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s, ok := w.storage.(interface{ LockFileName() string }); ok {
+		return s.LockFileName()
+	}
+	return ""
 }
 
 func (w *KeyStoreWallet) Add(name, privateKey string) error {
-	w.accounts[name] = account.NewAccount(name, privateKey, func() utils.ChainId {
-		return w.chainId
-	})
-	return w.save()
+	return w.addRecord(NewRecord(name, privateKey), true)
 }
 
 func (w *KeyStoreWallet) AddByMnemonic(name, mnemonic string) error {
@@ -71,108 +319,699 @@ func (w *KeyStoreWallet) AddByMnemonic(name, mnemonic string) error {
 	if err != nil {
 		return err
 	}
-	return w.Add(name,pri)
+	r := NewRecord(name, pri)
+	r.DerivationPath = utils.DefaultHDPath
+	r.Source = SourceMnemonic
+	return w.addRecord(r, true)
+}
+
+func (w *KeyStoreWallet) addRecord(r *Record, replace bool) error {
+	if err := w.ValidateKey(r.Name, r.PrivateKey); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if save, err := mergeRecord(r, w.records[r.Name], replace); !save {
+		return err
+	}
+	return w.put(r)
+}
+
+// encrypt and save a record, only this record is written to storage
+// caller must hold w.mu
+func (w *KeyStoreWallet) put(r *Record) error {
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	if isContactKey(r.Name) {
+		return errors.New("invalid account name: " + r.Name)
+	}
+	if err := w.syncHeader(); err != nil {
+		return err
+	}
+	seq := w.counter + 1
+	data, err := sealRecord(w.dataKey, r, seq)
+	if err != nil {
+		return err
+	}
+	if err := w.saveEntry(r.Name, seq, data); err != nil {
+		return err
+	}
+	w.setRecord(r.Name, r)
+	return nil
+}
+
+// save an entry sealed with sequence number seq, or delete it if data is nil, along with a header listing it
+// the header is saved after the entry, or before it's deleted, unless the storage saves them at once
+// if it fails, the keystore is read again on next change, see syncHeader. caller must hold w.mu
+func (w *KeyStoreWallet) saveEntry(name string, seq uint64, data []byte) error {
+	counter := w.counter
+	old, ok := w.manifest[name]
+	w.counter = seq
+	if data == nil {
+		delete(w.manifest, name)
+	} else {
+		w.manifest[name] = seq
+	}
+	err := w.saveHeaderWith(map[string][]byte{name: data})
+	if err != nil {
+		w.counter = counter
+		if ok {
+			w.manifest[name] = old
+		} else {
+			delete(w.manifest, name)
+		}
+		// what is in storage is unknown
+		w.headerSum = nil
+	}
+	return err
 }
 
 func (w *KeyStoreWallet) Remove(name string) error {
-	delete(w.accounts,name)
-	return w.save()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	if err := w.syncHeader(); err != nil {
+		return err
+	}
+	if err := w.saveEntry(name, w.counter+1, nil); err != nil {
+		return err
+	}
+	w.setRecord(name, nil)
+	return nil
 }
 
-func (w *KeyStoreWallet) load() error {
+// set record of name and its account, or delete them if r is nil, caller must hold w.mu
+func (w *KeyStoreWallet) setRecord(name string, r *Record) {
+	delete(w.damaged, name)
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if r == nil {
+		delete(w.records, name)
+		delete(w.accounts, name)
+		return
+	}
+	w.records[name] = r
+	w.accounts[name] = w.newAccount(r)
+}
+
+// replace all records and accounts, caller must hold w.mu
+func (w *KeyStoreWallet) setRecords(records map[string]*Record) {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if records == nil {
+		w.records, w.accounts = nil, nil
+		return
+	}
+	w.records = records
+	w.accounts = make(map[string]*account.Account, len(records))
+	for name, r := range records {
+		w.accounts[name] = w.newAccount(r)
+	}
+}
+
+// replace all contacts, caller must hold w.mu
+func (w *KeyStoreWallet) setContacts(contacts map[string]*Contact) {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	w.contacts = contacts
+}
 
-	keyJson, err := ioutil.ReadFile(w.fullFileName)
+// create the account of r, it has no key itself, the key is fetched from wallet for every signing
+func (w *KeyStoreWallet) newAccount(r *Record) *account.Account {
+	name := r.Name
+	return account.NewWalletAccount(name, func() utils.ChainId {
+		return w.chainId
+	}, func() (string, error) {
+		return w.privateKey(name)
+	}, func(ops []interface{}) (func(applied bool), error) {
+		return w.checkPolicy(name, ops)
+	})
+}
+
+// change keystore password, every entry is sealed again with a new data key, so the previous header, e.g. a backup,
+// can't decrypt anything saved after. a header with the new password and both data keys is saved first, then
+// entries are sealed again and saved along with a header without the previous key. if it's interrupted,
+// the new password is in effect, and the rest is done when the keystore is opened or unlocked next time
+// if backup is true, previous header is kept by the storage, which is still encrypted with old password
+// for a keystore file, the backup is BackupFileName(), a copy of the whole file before the change
+func (w *KeyStoreWallet) ChangePassword(oldPassword, newPassword string, backup bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(oldPassword), w.password) != 1 {
+		return ErrWrongPassword
+	}
+	if err := w.syncHeader(); err != nil {
+		return err
+	}
+	if backup {
+		b, ok := w.storage.(headerBackuper)
+		if !ok {
+			return errors.New("storage doesn't support backup")
+		}
+		if err := b.BackupHeader(); err != nil {
+			return err
+		}
+	}
+	dataKey, err := utils.NewKey()
 	if err != nil {
 		return err
 	}
-	var eks EncryptKeyStore
-	if err := json.Unmarshal(keyJson, &eks); err != nil {
+
+	oldPass, oldSalt, oldEncKey, oldMacKey := w.password, w.salt, w.encKey, w.macKey
+	w.password = []byte(newPassword)
+	w.salt, w.encKey, w.macKey = nil, nil, nil
+	w.prevDataKey, w.dataKey = w.dataKey, dataKey
+	if err := w.saveHeader(); err != nil {
+		// header is untouched if failed, keep using old password and data key
+		w.resetKey()
+		utils.ZeroBytes(w.password)
+		utils.ZeroBytes(dataKey)
+		w.password, w.salt, w.encKey, w.macKey = oldPass, oldSalt, oldEncKey, oldMacKey
+		w.dataKey, w.prevDataKey = w.prevDataKey, nil
+		w.headerSum = nil
 		return err
 	}
+	utils.ZeroBytes(oldPass)
+	utils.ZeroBytes(oldEncKey)
+	utils.ZeroBytes(oldMacKey)
+	return w.rekey()
+}
 
-	key := []byte(w.password)
-	iv, err := base64.StdEncoding.DecodeString(eks.Iv)
+// seal entries encrypted by the previous data key with current one, and save them along with a header
+// without the previous key, caller must hold w.mu
+func (w *KeyStoreWallet) rekey() error {
+	entries, err := loadEntries(w.storage)
 	if err != nil {
 		return err
 	}
-	cipher_data, err := base64.StdEncoding.DecodeString(eks.CipherText)
+	sealed := make(map[string][]byte)
+	for name, data := range entries {
+		var plain json.RawMessage
+		seq, err := openJSON(w.prevDataKey, name, data, &plain)
+		// sealed already, or damaged
+		if err != nil {
+			continue
+		}
+		sealed[name], err = sealJSON(w.dataKey, name, seq, plain)
+		utils.ZeroBytes(plain)
+		if err != nil {
+			return err
+		}
+	}
+	prevDataKey := w.prevDataKey
+	w.prevDataKey = nil
+	if err := w.saveHeaderWith(sealed); err != nil {
+		w.prevDataKey = prevDataKey
+		w.headerSum = nil
+		return err
+	}
+	utils.ZeroBytes(prevDataKey)
+	return nil
+}
+
+// return the file name of keystore backup made by ChangePassword
+// empty if the storage doesn't keep backups in a file, e.g. a LevelDBStorage keeps it in the database, or it's closed
+func (w *KeyStoreWallet) BackupFileName() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s, ok := w.storage.(interface{ BackupFileName() string }); ok {
+		return s.BackupFileName()
+	}
+	return ""
+}
+
+// decrypt header and all records from storage, caller must hold w.mu
+// return *DamagedRecordsError if some entries can't be used, other records are loaded
+func (w *KeyStoreWallet) load() error {
+	w.damaged = nil
+	header, err := w.storage.LoadHeader()
 	if err != nil {
 		return err
 	}
-	mac_data, err := base64.StdEncoding.DecodeString(eks.Mac)
+	// a new keystore
+	if header == nil {
+		// records can't be decrypted without header
+		if names, err := w.storage.List(); err != nil {
+			return err
+		} else if len(names) > 0 {
+			return ErrKeyStoreCorrupted
+		}
+		if w.dataKey, err = utils.NewKey(); err != nil {
+			return err
+		}
+		w.counter, w.manifest = 0, make(map[string]uint64)
+		w.setRecords(make(map[string]*Record))
+		w.setContacts(make(map[string]*Contact))
+		return w.saveHeader()
+	}
+
+	var eks EncryptKeyStore
+	if err := json.Unmarshal(header, &eks); err != nil {
+		return ErrKeyStoreCorrupted
+	}
+	if eks.Version < KeyStoreVersionStorage {
+		return w.migrate(eks.Version, header)
+	}
+	if eks.Version != KeyStoreVersionStorage {
+		return errors.New(fmt.Sprintf("unsupported keystore version %d", eks.Version))
+	}
+	payload, err := w.decryptAEAD(&eks)
 	if err != nil {
 		return err
 	}
-	mac := hmac.New(sha256.New, []byte(w.password))
-	calcMac := mac.Sum(nil)
-	if !hmac.Equal(mac_data, calcMac) {
-		return errors.New("password incorrect")
+	var keys keyStoreKeys
+	err = json.Unmarshal(payload, &keys)
+	utils.ZeroBytes(payload)
+	if err != nil || len(keys.DataKey) != utils.PasswordLength || (keys.PrevDataKey != nil && len(keys.PrevDataKey) != utils.PasswordLength) {
+		utils.ZeroBytes(keys.DataKey)
+		utils.ZeroBytes(keys.PrevDataKey)
+		return ErrKeyStoreCorrupted
+	}
+	if keys.Manifest == nil {
+		keys.Manifest = make(map[string]uint64)
 	}
+	headerSum := sha256.Sum256(header)
 
-	keyStoreData, err := utils.DecryptData(cipher_data, key, iv)
+	entries, err := loadEntries(w.storage)
 	if err != nil {
+		utils.ZeroBytes(keys.DataKey)
+		utils.ZeroBytes(keys.PrevDataKey)
 		return err
 	}
+	records := make(map[string]*Record, len(entries))
+	contacts := make(map[string]*Contact)
+	damaged := make(map[string]bool)
+	counter := keys.Counter
+	for name, data := range entries {
+		// an entry which can't be used doesn't stop others from being used
+		var (
+			r   *Record
+			c   *Contact
+			seq uint64
+			err error
+		)
+		for _, key := range [][]byte{keys.DataKey, keys.PrevDataKey} {
+			if key == nil {
+				continue
+			}
+			if isContactKey(name) {
+				c, seq, err = openContact(key, name, data)
+			} else {
+				r, seq, err = openRecord(key, name, data)
+			}
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			damaged[name] = true
+			continue
+		}
+		want, listed := keys.Manifest[name]
+		switch {
+		case listed && seq == want:
+		// saved right before a header which is never saved, e.g. the process crashed
+		case seq == keys.Counter+1:
+			keys.Manifest[name] = seq
+			counter = seq
+		// left by a delete whose entry is never deleted
+		case !listed && seq <= keys.Counter:
+			continue
+		// rolled back to an older version, or copied from another keystore
+		default:
+			damaged[name] = true
+			continue
+		}
+		if c != nil {
+			contacts[c.Name] = c
+		} else {
+			records[name] = r
+		}
+	}
+	for name := range keys.Manifest {
+		if _, ok := entries[name]; !ok {
+			damaged[name] = true
+		}
+	}
+	w.dataKey, w.prevDataKey = keys.DataKey, keys.PrevDataKey
+	w.counter, w.manifest = counter, keys.Manifest
+	w.headerSum = headerSum[:]
+	w.damaged = damaged
+	w.setRecords(records)
+	w.setContacts(contacts)
+	// a password change is interrupted
+	if w.prevDataKey != nil {
+		if err := w.rekey(); err != nil {
+			return err
+		}
+	}
+	if len(damaged) > 0 {
+		return &DamagedRecordsError{Names: w.damagedNames()}
+	}
+	return nil
+}
 
-	// gob decode
+func isDamaged(err error) bool {
+	_, ok := err.(*DamagedRecordsError)
+	return ok
+}
+
+// return names of entries which can't be used when the keystore is opened or unlocked, sorted, see DamagedRecordsError
+// contacts are named "#contact/<name>". they are left in storage untouched, and are dropped from the result
+// once replaced, e.g. by Add, AddContact or RestoreBackup, or deleted by Remove or RemoveContact
+func (w *KeyStoreWallet) DamagedRecords() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.damagedNames()
+}
+
+// caller must hold w.mu
+func (w *KeyStoreWallet) damagedNames() []string {
+	var names []string
+	for name := range w.damaged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// move accounts of a keystore in earlier versions to records, caller must hold w.mu
+// the original is copied first if the storage supports, e.g. FileStorage.LegacyBackupFileName
+// records are saved before header unless they are saved at once, an interrupted migration is redone on next open
+func (w *KeyStoreWallet) migrate(version int, header []byte) error {
+	records, err := w.decode(header)
+	if err != nil {
+		return err
+	}
+	if b, ok := w.storage.(legacyBackuper); ok {
+		if err := b.BackupLegacy(version); err != nil {
+			return err
+		}
+	}
+	// always save in current version with a new salt
+	w.resetKey()
+	if w.dataKey, err = utils.NewKey(); err != nil {
+		return err
+	}
+	w.counter, w.manifest = 1, make(map[string]uint64, len(records))
+	entries := make(map[string][]byte, len(records))
+	for name, r := range records {
+		if entries[name], err = sealRecord(w.dataKey, r, w.counter); err != nil {
+			return err
+		}
+		w.manifest[name] = w.counter
+	}
+	// left by an interrupted migration, encrypted by another data key
+	names, err := w.storage.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := records[name]; !ok {
+			entries[name] = nil
+		}
+	}
+	if err := w.saveHeaderWith(entries); err != nil {
+		return err
+	}
+	w.setRecords(records)
+	w.setContacts(make(map[string]*Contact))
+	return nil
+}
+
+// decrypt and decode records from a keystore file in earlier versions
+func (w *KeyStoreWallet) decode(keyJson []byte) (map[string]*Record, error) {
+	var eks EncryptKeyStore
+	if err := json.Unmarshal(keyJson, &eks); err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+
+	var (
+		keyStoreData []byte
+		err error
+	)
+	switch eks.Version {
+	case KeyStoreVersionLegacy:
+		keyStoreData, err = w.decryptLegacy(&eks)
+	case KeyStoreVersionScrypt:
+		keyStoreData, err = w.decryptScrypt(&eks)
+	case KeyStoreVersionAEAD, KeyStoreVersionJSON:
+		keyStoreData, err = w.decryptAEAD(&eks)
+	default:
+		err = errors.New(fmt.Sprintf("unsupported keystore version %d", eks.Version))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(keyStoreData)
+
+	if eks.Version >= KeyStoreVersionJSON {
+		return decodeContent(keyStoreData)
+	}
+
+	// gob decode, older versions store accounts directly
+	accounts := make(map[string]*legacyAccount)
 	var buf bytes.Buffer
 	buf.Write(keyStoreData)
 	dec := gob.NewDecoder(&buf)
-	if err := dec.Decode(&w.accounts); err != nil {
-		return err
+	if err := dec.Decode(&accounts); err != nil {
+		return nil, ErrKeyStoreCorrupted
 	}
+	return migrateAccounts(accounts), nil
+}
 
-	// set call back func
-	for _,v := range w.accounts {
-		v.GetChainIdCallBack = func() utils.ChainId {
-			return w.chainId
+// encrypt data key and manifest with the key derived from password and save them as header, caller must hold w.mu
+func (w *KeyStoreWallet) saveHeader() error {
+	return w.saveHeaderWith(nil)
+}
+
+// save header along with entries, see saveEntries, caller must hold w.mu
+func (w *KeyStoreWallet) saveHeaderWith(entries map[string][]byte) error {
+	if w.encKey == nil {
+		if err := w.deriveKey(nil); err != nil {
+			return err
 		}
 	}
 
+	params := w.kdfParams
+	encryptKeyStore := &EncryptKeyStore{
+		Version:    CurrentKeyStoreVersion,
+		Mac:        base64.StdEncoding.EncodeToString(passwordCheck(w.macKey)),
+		Kdf:        utils.KdfScrypt,
+		KdfParams:  &params,
+		Salt:       base64.StdEncoding.EncodeToString(w.salt),
+	}
+	payload, err := json.Marshal(&keyStoreKeys{DataKey: w.dataKey, PrevDataKey: w.prevDataKey, Counter: w.counter, Manifest: w.manifest})
+	if err != nil {
+		return err
+	}
+	defer utils.ZeroBytes(payload)
+
+	// aes-gcm encrypted
+	header, err := encryptKeyStore.header()
+	if err != nil {
+		return err
+	}
+	cipher_data, nonce, err := utils.SealData(payload, w.encKey, header)
+	if err != nil {
+		return err
+	}
+	encryptKeyStore.CipherText = base64.StdEncoding.EncodeToString(cipher_data)
+	encryptKeyStore.Iv = base64.StdEncoding.EncodeToString(nonce)
+
+	keyJson, err := json.Marshal(encryptKeyStore)
+	if err != nil {
+		return err
+	}
+	if err := saveEntries(w.storage, entries, keyJson); err != nil {
+		return err
+	}
+	headerSum := sha256.Sum256(keyJson)
+	w.headerSum = headerSum[:]
 	return nil
 }
 
-func (w *KeyStoreWallet) save() error {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(w.accounts)
+// reload the keystore if its header is changed by another tool since it's loaded or saved, e.g. a new password or
+// data key, so nothing is saved with a stale key. return ErrWrongPassword if the password is changed
+// caller must hold w.mu, and wallet is unlocked
+func (w *KeyStoreWallet) syncHeader() error {
+	header, err := w.storage.LoadHeader()
 	if err != nil {
 		return err
 	}
+	headerSum := sha256.Sum256(header)
+	if bytes.Equal(headerSum[:], w.headerSum) {
+		return nil
+	}
+	// damaged records are listed by DamagedRecords, they don't stop others from being saved
+	if err := w.load(); err != nil && !isDamaged(err) {
+		return err
+	}
+	return nil
+}
 
-	// aes encrypted
-	cipher_data, iv, err := utils.EncryptData(buf.Bytes(),[]byte(w.password))
+// read the keystore again, e.g. after accounts are changed by another tool, the wallet must be unlocked
+// accounts changed by others are not seen until then, unless the header is changed, see syncHeader
+// a *DamagedRecordsError is returned if some records can't be used
+func (w *KeyStoreWallet) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storage == nil {
+		return errNotOpen
+	}
+	if w.locked {
+		return ErrWalletLocked
+	}
+	return w.load()
+}
+
+// decrypt a keystore written before key derivation was introduced
+func (w *KeyStoreWallet) decryptLegacy(eks *EncryptKeyStore) ([]byte, error) {
+	iv, err := base64.StdEncoding.DecodeString(eks.Iv)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cipher_text := base64.StdEncoding.EncodeToString(cipher_data)
-	iv_text := base64.StdEncoding.EncodeToString(iv)
-	mac := hmac.New(sha256.New, []byte(w.password))
+	cipher_data, err := base64.StdEncoding.DecodeString(eks.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	mac_data, err := base64.StdEncoding.DecodeString(eks.Mac)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, w.password)
 	calcMac := mac.Sum(nil)
-	mac_text := base64.StdEncoding.EncodeToString(calcMac)
+	if !hmac.Equal(mac_data, calcMac) {
+		return nil, ErrWrongPassword
+	}
+	return utils.DecryptData(cipher_data, w.password, iv)
+}
 
-	encryptKeyStore := &EncryptKeyStore{
-		CipherText: cipher_text,
-		Iv:         iv_text,
-		Mac:        mac_text,
+// decrypt a keystore whose key is derived by scrypt
+func (w *KeyStoreWallet) decryptScrypt(eks *EncryptKeyStore) ([]byte, error) {
+	if eks.Kdf != utils.KdfScrypt || eks.KdfParams == nil {
+		return nil, errors.New("unsupported kdf " + eks.Kdf)
+	}
+	salt, err := base64.StdEncoding.DecodeString(eks.Salt)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(eks.Iv)
+	if err != nil {
+		return nil, err
+	}
+	cipher_data, err := base64.StdEncoding.DecodeString(eks.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	mac_data, err := base64.StdEncoding.DecodeString(eks.Mac)
+	if err != nil {
+		return nil, err
+	}
+	encKey, macKey, err := utils.DeriveKey(w.password, salt, *eks.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac_data, cipherMac(macKey, iv, cipher_data)) {
+		return nil, ErrWrongPassword
 	}
 
-	// save to file
-	return w.seal(encryptKeyStore)
+	// keep the file's parameters until they are changed explicitly
+	w.kdfParams = *eks.KdfParams
+	w.salt, w.encKey, w.macKey = salt, encKey, macKey
+	return utils.DecryptDataWithKey(cipher_data, encKey, iv)
 }
 
-func (w *KeyStoreWallet) seal(data *EncryptKeyStore) error {
+// decrypt a keystore sealed by aes-gcm
+func (w *KeyStoreWallet) decryptAEAD(eks *EncryptKeyStore) ([]byte, error) {
+	if eks.Kdf != utils.KdfScrypt || eks.KdfParams == nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	salt, err := base64.StdEncoding.DecodeString(eks.Salt)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	nonce, err := base64.StdEncoding.DecodeString(eks.Iv)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	cipher_data, err := base64.StdEncoding.DecodeString(eks.CipherText)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	check, err := base64.StdEncoding.DecodeString(eks.Mac)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	encKey, macKey, err := utils.DeriveKey(w.password, salt, *eks.KdfParams)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	// password is checked separately, so that a failed decryption means a damaged file
+	if !hmac.Equal(check, passwordCheck(macKey)) {
+		return nil, ErrWrongPassword
+	}
+	header, err := eks.header()
+	if err != nil {
+		return nil, err
+	}
+	data, err := utils.OpenData(cipher_data, encKey, nonce, header)
+	if err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+
+	w.kdfParams = *eks.KdfParams
+	w.salt, w.encKey, w.macKey = salt, encKey, macKey
+	return data, nil
+}
 
-	// I knew there is a problem when user create a pair key but using a name which have been occupied.
-	// fixme
-	if w.fullFileName == "" {
-		return errNotOpen
+// derive keys from password, a new salt is generated if salt is nil
+func (w *KeyStoreWallet) deriveKey(salt []byte) error {
+	var err error
+	if salt == nil {
+		if salt, err = utils.NewSalt(); err != nil {
+			return err
+		}
 	}
-	path := filepath.Join(w.fullFileName)
-	keyJson, err := json.Marshal(data)
+	encKey, macKey, err := utils.DeriveKey(w.password, salt, w.kdfParams)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(path, keyJson, 0600)
-	return err
-}
\ No newline at end of file
+	w.salt, w.encKey, w.macKey = salt, encKey, macKey
+	return nil
+}
+
+// forget derived keys, next save will derive new ones with a new salt
+func (w *KeyStoreWallet) resetKey() {
+	utils.ZeroBytes(w.encKey)
+	utils.ZeroBytes(w.macKey)
+	w.salt, w.encKey, w.macKey = nil, nil, nil
+}
+
+func cipherMac(key, iv, cipherData []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(iv)
+	mac.Write(cipherData)
+	return mac.Sum(nil)
+}
+
+func passwordCheck(macKey []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write([]byte(passwordCheckMessage))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/coschain/cos-sdk-go/utils"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// keystores in testdata are written by earlier versions of KeyStoreWallet, with accounts alice1 and bobby1
+// and password "password". versions 1 to 3 use scrypt N 1<<10, r 8, p 1. the original is copied before migrated
+func TestKeyStoreMigration(t *testing.T) {
+	for version := KeyStoreVersionLegacy; version < KeyStoreVersionStorage; version++ {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", fmt.Sprintf("keystore-v%d.json", version)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileName := filepath.Join(t.TempDir(), "test.key")
+		if err := ioutil.WriteFile(fileName, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		w := NewKeyStoreWallet("127.0.0.1:1", utils.Dev)
+		w.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+		if err := w.Open(fileName, "wrong"); err != ErrWrongPassword {
+			t.Fatalf("version %d: wrong password got %v", version, err)
+		}
+		if err := w.Open(fileName, "password"); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		checkTestAccounts(t, w)
+		w.Close()
+
+		// the original is kept
+		backup, err := ioutil.ReadFile(fmt.Sprintf("%s.v%d.bak", fileName, version))
+		if err != nil || !bytes.Equal(backup, data) {
+			t.Fatalf("version %d: backup differs from original, error %v", version, err)
+		}
+
+		// saved in current version, and opened again
+		data, err = ioutil.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f keyStoreFile
+		if err := json.Unmarshal(data, &f); err != nil || f.Version != KeyStoreVersionStorage {
+			t.Fatalf("version %d: migrated to version %d, error %v", version, f.Version, err)
+		}
+		w = NewKeyStoreWallet("127.0.0.1:1", utils.Dev)
+		if err := w.Open(fileName, "password"); err != nil {
+			t.Fatalf("version %d: open after migration: %v", version, err)
+		}
+		checkTestAccounts(t, w)
+		w.Close()
+	}
+}
+
+// changes saved by another tool ignoring the lock are merged, not overwritten
+func TestKeyStoreExternalChanges(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.key")
+	w, err := openTestFile(t, fileName, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	other, err := openTestStorage(t, &FileStorage{fileName: fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Add("bobby1", testKey2); err != nil {
+		t.Fatal(err)
+	}
+
+	// header is changed by other, w reloads it before saving
+	if err := w.AddContact("carol1", Metadata{Notes: "friend"}); err != nil {
+		t.Fatal(err)
+	}
+	checkTestAccounts(t, w)
+	if err := other.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestAccounts(t, other)
+	if c := other.GetContact("carol1"); c == nil || c.Notes != "friend" {
+		t.Fatalf("got contact %+v", c)
+	}
+
+	// nothing is saved with a stale password
+	if err := other.ChangePassword("password", "new", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("dave01", testKey); err != ErrWrongPassword {
+		t.Fatalf("add after password changed by other got %v", err)
+	}
+	w.Close()
+	other.Close()
+	w, err = openTestFile(t, fileName, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestAccounts(t, w)
+}
@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+// wait until the wallet is locked automatically
+func waitLocked(t *testing.T, w *KeyStoreWallet) {
+	for deadline := time.Now().Add(5 * time.Second); !w.IsLocked(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("wallet is not locked after timeout")
+		}
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	w := newTestKeyStoreWallet(t, "127.0.0.1:1")
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	acc := w.Account("alice1")
+	if w.IsLocked() {
+		t.Fatal("wallet is locked after opened")
+	}
+
+	w.Lock()
+	if !w.IsLocked() {
+		t.Fatal("wallet is not locked")
+	}
+	// accounts are listed, but keys are gone
+	if w.Account("alice1") == nil {
+		t.Fatal("account is not listed when locked")
+	}
+	if _, err := acc.SignMessage([]byte("hello")); err != ErrWalletLocked {
+		t.Fatalf("sign when locked got %v", err)
+	}
+	if _, err := w.ExportPrivateKey("alice1"); err != ErrWalletLocked {
+		t.Fatalf("export when locked got %v", err)
+	}
+	if err := w.Add("bobby1", testKey2); err != ErrWalletLocked {
+		t.Fatalf("add when locked got %v", err)
+	}
+	if r := w.record("alice1"); r.PrivateKey != "" {
+		t.Fatal("private key is kept in memory when locked")
+	}
+
+	if err := w.Unlock("wrong", 0); err != ErrWrongPassword {
+		t.Fatalf("unlock with wrong password got %v", err)
+	}
+	if !w.IsLocked() {
+		t.Fatal("wallet is unlocked with wrong password")
+	}
+	if err := w.Unlock("password", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acc.SignMessage([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// an unlocked wallet checks password too
+	if err := w.Unlock("wrong", 0); err != ErrWrongPassword {
+		t.Fatalf("unlock an unlocked wallet with wrong password got %v", err)
+	}
+	if w.IsLocked() {
+		t.Fatal("wallet is locked by a wrong password")
+	}
+}
+
+func TestAutoLock(t *testing.T) {
+	w := newTestKeyStoreWallet(t, "127.0.0.1:1")
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unlock("password", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitLocked(t, w)
+	if _, err := w.ExportPrivateKey("alice1"); err != ErrWalletLocked {
+		t.Fatalf("export after auto-locked got %v", err)
+	}
+
+	// unlocking again replaces the timeout, 0 never locks automatically
+	if err := w.Unlock("password", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unlock("password", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if w.IsLocked() {
+		t.Fatal("wallet is locked by a replaced timeout")
+	}
+
+	// a locked wallet is unlocked with a new timeout
+	w.Lock()
+	if err := w.Unlock("password", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitLocked(t, w)
+}
@@ -4,34 +4,53 @@ import (
 	"github.com/coschain/cos-sdk-go/account"
 	"github.com/coschain/cos-sdk-go/rpcclient"
 	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
 )
 
 type MemWallet struct {
 	BaseWallet
 }
 
-func NewMemWallet(ip string, chainId utils.ChainId) *MemWallet {
+// create a wallet keeping accounts in memory, imported keys are checked against the chain
+// unless opts has WithOfflineImport()
+func NewMemWallet(ip string, chainId utils.ChainId, opts ...Option) *MemWallet {
 	if err := rpcclient.ConnectRpc(ip); err != nil {
 		return nil
 	}
 	w := &MemWallet{}
 	w.accounts = make(map[string]*account.Account)
+	w.records = make(map[string]*Record)
+	w.contacts = make(map[string]*Contact)
 	w.chainId = chainId
+	w.store = w
+	for _, opt := range opts {
+		opt(&w.BaseWallet)
+	}
 	return w
 }
 
-func (w *MemWallet) Close() {
+func (w *MemWallet) Close() error {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
 	w.accounts = nil
+	w.records = nil
+	w.contacts = nil
+	return nil
 }
 
-func (w *MemWallet) Add(name, privateKey string) {
-	w.accounts[name] = account.NewAccount(name, privateKey, func() utils.ChainId {
-		return w.chainId
-	})
+func (w *MemWallet) Add(name, privateKey string) error {
+	return w.addRecord(NewRecord(name, privateKey), true)
 }
 
-func (w *MemWallet) Remove(name string) {
+func (w *MemWallet) Remove(name string) error {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return ErrWalletClosed
+	}
 	delete(w.accounts,name)
+	delete(w.records,name)
+	return nil
 }
 
 func (w *MemWallet) AddByMnemonic(name, mnemonic string) error {
@@ -39,6 +58,51 @@ func (w *MemWallet) AddByMnemonic(name, mnemonic string) error {
 	if err != nil {
 		return err
 	}
-	w.Add(name,pri)
+	r := NewRecord(name, pri)
+	r.DerivationPath = utils.DefaultHDPath
+	r.Source = SourceMnemonic
+	return w.addRecord(r, true)
+}
+
+func (w *MemWallet) addRecord(r *Record, replace bool) error {
+	if err := w.ValidateKey(r.Name, r.PrivateKey); err != nil {
+		return err
+	}
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return ErrWalletClosed
+	}
+	if save, err := mergeRecord(r, w.records[r.Name], replace); !save {
+		return err
+	}
+	w.setRecord(r)
 	return nil
 }
+
+// set record and account of r.Name, caller must hold write lock of dataMu
+func (w *MemWallet) setRecord(r *Record) {
+	w.records[r.Name] = r
+	name := r.Name
+	w.accounts[name] = account.NewWalletAccount(name, func() utils.ChainId {
+		return w.chainId
+	}, func() (string, error) {
+		return w.privateKey(name)
+	}, func(ops []interface{}) (func(applied bool), error) {
+		return w.checkPolicy(name, ops)
+	})
+}
+
+// return private key of an account for signing
+func (w *MemWallet) privateKey(name string) (string, error) {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	r, ok := w.records[name]
+	if !ok {
+		return "", errors.New("account not in wallet: " + name)
+	}
+	if r.WatchOnly {
+		return "", ErrWatchOnly
+	}
+	return r.PrivateKey, nil
+}
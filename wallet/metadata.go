@@ -0,0 +1,132 @@
+package wallet
+
+import (
+	"github.com/kataras/go-errors"
+	"sort"
+	"strings"
+)
+
+// Metadata is what users note about an account or a contact, it's encrypted along with keys in keystore
+type Metadata struct {
+	Labels []string          `json:"labels,omitempty"`
+	Notes  string            `json:"notes,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// return a deep copy, nil labels and tags are kept nil
+func (m Metadata) copy() Metadata {
+	c := m
+	if m.Labels != nil {
+		c.Labels = append([]string{}, m.Labels...)
+	}
+	if m.Tags != nil {
+		c.Tags = make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			c.Tags[k] = v
+		}
+	}
+	return c
+}
+
+func (m Metadata) empty() bool {
+	return len(m.Labels) == 0 && m.Notes == "" && len(m.Tags) == 0
+}
+
+// return true if label is one of labels
+func (m Metadata) HasLabel(label string) bool {
+	for _, l := range m.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// return true if query is in labels, notes, keys or values of tags, case-insensitively
+func (m Metadata) contains(query string) bool {
+	if strings.Contains(strings.ToLower(m.Notes), query) {
+		return true
+	}
+	for _, l := range m.Labels {
+		if strings.Contains(strings.ToLower(l), query) {
+			return true
+		}
+	}
+	for k, v := range m.Tags {
+		if strings.Contains(strings.ToLower(k), query) || strings.Contains(strings.ToLower(v), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// return copies of records whose name or metadata contains query case-insensitively, sorted by name
+// an empty query matches all records. private keys are cleared in copies like GetRecord
+func (w *BaseWallet) SearchRecords(query string) []*Record {
+	query = strings.ToLower(query)
+	return w.filterRecords(func(r *Record) bool {
+		return strings.Contains(strings.ToLower(r.Name), query) || r.Metadata.contains(query)
+	})
+}
+
+// return copies of records with label, sorted by name, private keys are cleared
+func (w *BaseWallet) RecordsByLabel(label string) []*Record {
+	return w.filterRecords(func(r *Record) bool {
+		return r.HasLabel(label)
+	})
+}
+
+func (w *BaseWallet) filterRecords(match func(r *Record) bool) []*Record {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	var records []*Record
+	for _, r := range w.records {
+		if match(r) {
+			c := r.Copy()
+			c.clearPrivateKeys()
+			records = append(records, c)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+	return records
+}
+
+// keep metadata of an account being added again with none
+func keepMetadata(r, old *Record) {
+	if r.Metadata.empty() {
+		r.Metadata = old.Metadata.copy()
+	}
+}
+
+// replace labels, notes and tags of an account in wallet
+func (w *MemWallet) SetMetadata(name string, m Metadata) error {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return ErrWalletClosed
+	}
+	r, ok := w.records[name]
+	if !ok {
+		return errors.New("account not in wallet: " + name)
+	}
+	r.Metadata = m.copy()
+	return nil
+}
+
+// replace labels, notes and tags of an account in wallet, only the record of the account is saved
+func (w *KeyStoreWallet) SetMetadata(name string, m Metadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.locked {
+		return ErrWalletLocked
+	}
+	old, ok := w.records[name]
+	if !ok {
+		return errors.New("account not in wallet: " + name)
+	}
+	r := old.Copy()
+	r.Metadata = m.copy()
+	return w.put(r)
+}
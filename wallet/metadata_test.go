@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"github.com/coschain/cos-sdk-go/utils"
+	"reflect"
+	"testing"
+)
+
+type organizingWallet interface {
+	Wallet
+	Organizer
+}
+
+// names of records or contacts
+func recordNames(records []*Record) []string {
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func contactNames(contacts []*Contact) []string {
+	var names []string
+	for _, c := range contacts {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestMetadata(t *testing.T) {
+	mem := NewMemWallet("127.0.0.1:1", utils.Dev, WithOfflineImport())
+	defer mem.Close()
+	for _, w := range []organizingWallet{newTestKeyStoreWallet(t, "127.0.0.1:1"), mem} {
+		if err := w.Add("alice1", testKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add("bobby1", testKey2); err != nil {
+			t.Fatal(err)
+		}
+		m := Metadata{Labels: []string{"hot", "trading"}, Notes: "Exchange deposits", Tags: map[string]string{"desk": "asia"}}
+		if err := w.SetMetadata("alice1", m); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.SetMetadata("carol1", m); err == nil {
+			t.Fatalf("%T: set metadata of an account not in wallet", w)
+		}
+		// metadata is copied
+		m.Labels[0] = "cold"
+
+		if names := recordNames(w.RecordsByLabel("hot")); !reflect.DeepEqual(names, []string{"alice1"}) {
+			t.Fatalf("%T: got %v by label", w, names)
+		}
+		for _, query := range []string{"EXCHANGE", "asia", "desk", "trad", "alice"} {
+			if names := recordNames(w.SearchRecords(query)); !reflect.DeepEqual(names, []string{"alice1"}) {
+				t.Fatalf("%T: got %v by query %q", w, names, query)
+			}
+		}
+		if names := recordNames(w.SearchRecords("")); !reflect.DeepEqual(names, []string{"alice1", "bobby1"}) {
+			t.Fatalf("%T: got %v by empty query", w, names)
+		}
+		for _, r := range w.SearchRecords("") {
+			if r.PrivateKey != "" {
+				t.Fatalf("%T: private key in search result", w)
+			}
+		}
+
+		// adding the account again keeps its metadata
+		if err := w.Add("alice1", testKey); err != nil {
+			t.Fatal(err)
+		}
+		if r := w.GetRecord("alice1"); r.Notes != "Exchange deposits" || !r.HasLabel("hot") {
+			t.Fatalf("%T: got record %+v", w, r)
+		}
+	}
+}
+
+func TestAddressBook(t *testing.T) {
+	mem := NewMemWallet("127.0.0.1:1", utils.Dev, WithOfflineImport())
+	defer mem.Close()
+	for _, w := range []organizingWallet{newTestKeyStoreWallet(t, "127.0.0.1:1"), mem} {
+		if err := w.AddContact("", Metadata{}); err != ErrInvalidContact {
+			t.Fatalf("%T: empty name got %v", w, err)
+		}
+		if err := w.AddContact("carol1", Metadata{Labels: []string{"vendor"}, Notes: "pays monthly"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddContact("dave01", Metadata{Labels: []string{"friend"}}); err != nil {
+			t.Fatal(err)
+		}
+		created := w.GetContact("carol1").CreatedTime
+		if created == 0 {
+			t.Fatalf("%T: creation time is not set", w)
+		}
+		// replaced metadata keeps the creation time
+		if err := w.AddContact("carol1", Metadata{Labels: []string{"vendor"}, Notes: "pays weekly"}); err != nil {
+			t.Fatal(err)
+		}
+		if c := w.GetContact("carol1"); c.Notes != "pays weekly" || c.CreatedTime != created {
+			t.Fatalf("%T: got contact %+v", w, c)
+		}
+
+		if names := contactNames(w.GetAllContacts()); !reflect.DeepEqual(names, []string{"carol1", "dave01"}) {
+			t.Fatalf("%T: got contacts %v", w, names)
+		}
+		if names := contactNames(w.ContactsByLabel("friend")); !reflect.DeepEqual(names, []string{"dave01"}) {
+			t.Fatalf("%T: got %v by label", w, names)
+		}
+		if names := contactNames(w.SearchContacts("WEEKLY")); !reflect.DeepEqual(names, []string{"carol1"}) {
+			t.Fatalf("%T: got %v by query", w, names)
+		}
+		// contacts are not accounts
+		if w.Account("carol1") != nil || len(w.GetAllAccounts()) != 0 {
+			t.Fatalf("%T: contact is listed as an account", w)
+		}
+
+		if err := w.RemoveContact("dave01"); err != nil {
+			t.Fatal(err)
+		}
+		if w.GetContact("dave01") != nil {
+			t.Fatalf("%T: contact is not removed", w)
+		}
+	}
+}
+
+// metadata and contacts are encrypted in keystore along with keys
+func TestMetadataSaved(t *testing.T) {
+	w := newTestKeyStoreWallet(t, "127.0.0.1:1")
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetMetadata("alice1", Metadata{Labels: []string{"hot"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddContact("carol1", Metadata{Notes: "vendor"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddContact("dave01", Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RemoveContact("dave01"); err != nil {
+		t.Fatal(err)
+	}
+	w.Lock()
+	if err := w.SetMetadata("alice1", Metadata{}); err != ErrWalletLocked {
+		t.Fatalf("set metadata when locked got %v", err)
+	}
+	if err := w.AddContact("erin01", Metadata{}); err != ErrWalletLocked {
+		t.Fatalf("add contact when locked got %v", err)
+	}
+	if err := w.Unlock("password", 0); err != nil {
+		t.Fatal(err)
+	}
+	if r := w.GetRecord("alice1"); !r.HasLabel("hot") {
+		t.Fatalf("got record %+v", r)
+	}
+	if names := contactNames(w.GetAllContacts()); !reflect.DeepEqual(names, []string{"carol1"}) || w.GetContact("carol1").Notes != "vendor" {
+		t.Fatalf("got contacts %v", names)
+	}
+}
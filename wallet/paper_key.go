@@ -0,0 +1,206 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+const (
+	// every paper key starts with it
+	PaperKeyPrefix  = "COSP"
+	PaperKeyVersion = 1
+
+	paperKeySaltLength     = 8
+	paperKeyPubKeyLength   = 33
+	paperKeyPrivKeyLength  = 32
+	paperKeyChecksumLength = 4
+	paperKeyMaxNameLength  = 255
+	// N is stored as log2(N) in a byte, the cost of parameters is also bounded by KdfParams.Validate
+	paperKeyMaxLogN = 22
+)
+
+var (
+	// scrypt parameters of BIP38, a paper key is decrypted in about a second on a common machine
+	PaperKeyKdfParams = utils.KdfParams{N: 1 << 14, R: 8, P: 8}
+
+	ErrPaperKeyInvalid  = errors.New("invalid paper key")
+	ErrPaperKeyChecksum = errors.New("paper key checksum mismatch, check for typos")
+)
+
+// paper keys are encoded by upper case base32 without padding, which is QR alphanumeric mode
+var paperKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encode an account to a printable string, its private key is encrypted with passphrase, BIP38-style
+//
+//	PaperKeyPrefix | base32(version | log2(N) | r | p | salt | public key | encrypted private key | name length | name | checksum)
+//
+// the private key is split into halves, each is xor-ed with the first half of the scrypt derived key,
+// then aes-256 encrypted by the second half. checksum is the first 4 bytes of double sha256 of all before it
+func EncodePaperKey(r *Record, passphrase string, params utils.KdfParams) (string, error) {
+	if r.WatchOnly {
+		return "", ErrWatchOnly
+	}
+	if len(r.Name) == 0 || len(r.Name) > paperKeyMaxNameLength {
+		return "", errors.New("account name can't be used in a paper key: " + r.Name)
+	}
+	if params.Validate() != nil || bits.TrailingZeros(uint(params.N)) > paperKeyMaxLogN || params.R > 255 || params.P > 255 {
+		return "", errors.New(fmt.Sprintf("kdf parameters can't be used in a paper key: %+v", params))
+	}
+	privKey, err := prototype.PrivateKeyFromWIF(r.PrivateKey)
+	if err != nil || privKey.Validate() != nil {
+		return "", ErrInvalidPrivateKey
+	}
+	pubKey, err := privKey.PubKey()
+	if err != nil {
+		return "", ErrInvalidPrivateKey
+	}
+	salt, err := utils.NewSalt()
+	if err != nil {
+		return "", err
+	}
+	salt = salt[:paperKeySaltLength]
+	encrypted, err := paperKeyCipher(privKey.Data, passphrase, salt, params, true)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(PaperKeyVersion)
+	buf.WriteByte(byte(bits.TrailingZeros(uint(params.N))))
+	buf.WriteByte(byte(params.R))
+	buf.WriteByte(byte(params.P))
+	buf.Write(salt)
+	buf.Write(pubKey.Data)
+	buf.Write(encrypted)
+	buf.WriteByte(byte(len(r.Name)))
+	buf.WriteString(r.Name)
+	buf.Write(paperKeyChecksum(buf.Bytes()))
+	return PaperKeyPrefix + paperKeyEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decode a paper key, white spaces in it are ignored, e.g. line breaks of a printed key
+// return ErrPaperKeyChecksum if it's mistyped, ErrWrongPassword if passphrase is incorrect
+func DecodePaperKey(paperKey, passphrase string) (*Record, error) {
+	paperKey = strings.Map(func(c rune) rune {
+		if unicode.IsSpace(c) {
+			return -1
+		}
+		return unicode.ToUpper(c)
+	}, paperKey)
+	if !strings.HasPrefix(paperKey, PaperKeyPrefix) {
+		return nil, ErrPaperKeyInvalid
+	}
+	data, err := paperKeyEncoding.DecodeString(paperKey[len(PaperKeyPrefix):])
+	if err != nil {
+		return nil, ErrPaperKeyInvalid
+	}
+	const fixedLength = 4 + paperKeySaltLength + paperKeyPubKeyLength + paperKeyPrivKeyLength + 1
+	if len(data) < fixedLength+paperKeyChecksumLength {
+		return nil, ErrPaperKeyInvalid
+	}
+	payload, checksum := data[:len(data)-paperKeyChecksumLength], data[len(data)-paperKeyChecksumLength:]
+	if !bytes.Equal(checksum, paperKeyChecksum(payload)) {
+		return nil, ErrPaperKeyChecksum
+	}
+	if payload[0] != PaperKeyVersion {
+		return nil, errors.New(fmt.Sprintf("unsupported paper key version %d", payload[0]))
+	}
+	if payload[1] == 0 || payload[1] > paperKeyMaxLogN || len(payload) != fixedLength+int(payload[fixedLength-1]) {
+		return nil, ErrPaperKeyInvalid
+	}
+	// r and p come from the key, a crafted key can't make scrypt exceed MaxKdfMemory or MaxKdfCost
+	params := utils.KdfParams{N: 1 << payload[1], R: int(payload[2]), P: int(payload[3])}
+	if params.Validate() != nil {
+		return nil, ErrPaperKeyInvalid
+	}
+	pos := 4
+	salt := payload[pos : pos+paperKeySaltLength]
+	pos += paperKeySaltLength
+	pubKey := prototype.PublicKeyFromBytes(payload[pos : pos+paperKeyPubKeyLength])
+	pos += paperKeyPubKeyLength
+	encrypted := payload[pos : pos+paperKeyPrivKeyLength]
+	name := string(payload[fixedLength:])
+
+	plain, err := paperKeyCipher(encrypted, passphrase, salt, params, false)
+	if err != nil {
+		return nil, ErrPaperKeyInvalid
+	}
+	defer utils.ZeroBytes(plain)
+	privKey := prototype.PrivateKeyFromBytes(plain)
+	// a wrong passphrase decrypts to another key
+	derived, err := privKey.PubKey()
+	if err != nil || !derived.Equal(pubKey) {
+		return nil, ErrWrongPassword
+	}
+	r := NewRecord(name, privKey.ToWIF())
+	r.Source = SourcePaperKey
+	return r, nil
+}
+
+// encrypt or decrypt a 32 bytes private key
+func paperKeyCipher(data []byte, passphrase string, salt []byte, params utils.KdfParams, encrypt bool) ([]byte, error) {
+	xorKey, aesKey, err := utils.DeriveKey([]byte(passphrase), salt, params)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(xorKey)
+	defer utils.ZeroBytes(aesKey)
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, paperKeyPrivKeyLength)
+	for i := 0; i < paperKeyPrivKeyLength; i += aes.BlockSize {
+		if encrypt {
+			var half [aes.BlockSize]byte
+			for j := range half {
+				half[j] = data[i+j] ^ xorKey[i+j]
+			}
+			block.Encrypt(out[i:i+aes.BlockSize], half[:])
+		} else {
+			block.Decrypt(out[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+			for j := 0; j < aes.BlockSize; j++ {
+				out[i+j] ^= xorKey[i+j]
+			}
+		}
+	}
+	return out, nil
+}
+
+func paperKeyChecksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:paperKeyChecksumLength]
+}
+
+// export an account to a paper key encrypted with passphrase, see EncodePaperKey
+// return ErrWalletLocked if it's a locked keystore wallet
+func (w *BaseWallet) ExportPaperKey(name, passphrase string) (string, error) {
+	r := w.record(name)
+	if r == nil {
+		return "", errors.New("account not in wallet: " + name)
+	}
+	// private keys are cleared when a keystore wallet is locked
+	if !r.WatchOnly && r.PrivateKey == "" {
+		return "", ErrWalletLocked
+	}
+	return EncodePaperKey(r, passphrase, PaperKeyKdfParams)
+}
+
+// import an account from a paper key, return name of the account
+func (w *BaseWallet) ImportPaperKey(paperKey, passphrase string) (string, error) {
+	r, err := DecodePaperKey(paperKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return r.Name, w.store.addRecord(r, true)
+}
@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"github.com/coschain/cos-sdk-go/utils"
+	"strings"
+	"testing"
+)
+
+const (
+	paperKeyPassphrase = "paper passphrase"
+	// account alice with testKey, scrypt N 1<<10, r 8, p 1, paper keys printed by older versions must stay readable
+	paperKeyVector = "COSPAEFAQANOIU5QGPXHCKAQGMWYPRONJMY5QHC3AEFPIKROIE5PEU64HKI32PKTY2ZMIUURYPPH7XST2RPSVXGIP5CRMEG2MUWR4ZQSQWAEAJOZRHMO65GXBCJDLVVQKYLMNFRWLDSZQ36Q"
+)
+
+func TestDecodePaperKeyVector(t *testing.T) {
+	// line breaks and lower case of a typed key are ignored
+	typed := strings.ToLower(paperKeyVector[:40]) + "\n" + paperKeyVector[40:]
+	r, err := DecodePaperKey(typed, paperKeyPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "alice" || r.PrivateKey != testKey || r.PublicKey != testPubKey || r.Source != SourcePaperKey {
+		t.Fatalf("got record %+v", r)
+	}
+}
+
+func TestPaperKeyRoundTrip(t *testing.T) {
+	params := utils.KdfParams{N: 1 << 10, R: 8, P: 1}
+	paperKey, err := EncodePaperKey(NewRecord("bob", testKey2), "another passphrase", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := DecodePaperKey(paperKey, "another passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "bob" || r.PrivateKey != testKey2 {
+		t.Fatalf("got record %+v", r)
+	}
+	if _, err := EncodePaperKey(&Record{Name: "bob", PublicKey: testPubKey2, WatchOnly: true}, "passphrase", params); err != ErrWatchOnly {
+		t.Fatalf("watch-only account got %v", err)
+	}
+}
+
+func TestDecodePaperKeyErrors(t *testing.T) {
+	if _, err := DecodePaperKey(paperKeyVector, "wrong"); err != ErrWrongPassword {
+		t.Fatalf("wrong passphrase got %v", err)
+	}
+	typo := []byte(paperKeyVector)
+	typo[20] = 'A' + (typo[20]-'A'+1)%26
+	if _, err := DecodePaperKey(string(typo), paperKeyPassphrase); err != ErrPaperKeyChecksum {
+		t.Fatalf("mistyped key got %v", err)
+	}
+	if _, err := DecodePaperKey("COSQ"+paperKeyVector[4:], paperKeyPassphrase); err != ErrPaperKeyInvalid {
+		t.Fatalf("wrong prefix got %v", err)
+	}
+
+	// a crafted key with a valid checksum can't make scrypt use too much memory
+	data, err := paperKeyEncoding.DecodeString(paperKeyVector[len(PaperKeyPrefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := data[:len(data)-paperKeyChecksumLength]
+	payload[1], payload[2], payload[3] = paperKeyMaxLogN, 255, 255
+	crafted := PaperKeyPrefix + paperKeyEncoding.EncodeToString(append(payload, paperKeyChecksum(payload)...))
+	if _, err := DecodePaperKey(crafted, paperKeyPassphrase); err != ErrPaperKeyInvalid {
+		t.Fatalf("expensive kdf parameters got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/coschain/cos-sdk-go/utils"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangePassword(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.key")
+	w, err := openTestFile(t, fileName, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ChangePassword("wrong", "new", true); err != ErrWrongPassword {
+		t.Fatalf("wrong password got %v", err)
+	}
+	if err := w.ChangePassword("old", "new", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("bobby1", testKey2); err != nil {
+		t.Fatal(err)
+	}
+	backupName := w.BackupFileName()
+	w.Close()
+
+	if _, err := openTestFile(t, fileName, "old"); err != ErrWrongPassword {
+		t.Fatalf("old password got %v", err)
+	}
+	w, err = openTestFile(t, fileName, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestAccounts(t, w)
+	w.Close()
+
+	// the backup opens with the old password, as it was before the change
+	b, err := openTestFile(t, backupName, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.GetAllAccounts()) != 1 || b.Account("alice1") == nil {
+		t.Fatalf("backup has accounts %v", b.GetAllAccounts())
+	}
+	b.Close()
+}
+
+// the old password and the backup header decrypt nothing in the keystore after the change
+func TestChangePasswordBackupHeader(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "test.key")
+	w, err := openTestFile(t, fileName, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ChangePassword("old", "new", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("bobby1", testKey2); err != nil {
+		t.Fatal(err)
+	}
+	backupName := w.BackupFileName()
+	w.Close()
+
+	var current, backup keyStoreFile
+	readKeyStoreFile(t, fileName, &current)
+	readKeyStoreFile(t, backupName, &backup)
+	current.Header = backup.Header
+	forged := filepath.Join(dir, "forged.key")
+	data, _ := json.Marshal(&current)
+	if err := ioutil.WriteFile(forged, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openTestFile(t, forged, "old")
+	var derr *DamagedRecordsError
+	if !errors.As(err, &derr) || len(derr.Names) != 2 {
+		t.Fatalf("open with backup header got %v", err)
+	}
+	if n := len(f.GetAllAccounts()); n != 0 {
+		t.Fatalf("%d accounts decrypted with backup header", n)
+	}
+}
+
+// a password change interrupted after the new header is saved is finished on next open
+func TestChangePasswordInterrupted(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keystore")
+	ds, err := NewDirStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &failingStorage{DirStorage: ds}
+	w, err := openTestStorage(t, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]string{"alice1": testKey, "bobby1": testKey2} {
+		if err := w.Add(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.failSave = true
+	if err := w.ChangePassword("password", "new", false); err == nil {
+		t.Fatal("save failure is ignored")
+	}
+	w.Close()
+
+	open := func(password string) (*KeyStoreWallet, error) {
+		ds, err := NewDirStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := NewKeyStoreWallet("127.0.0.1:1", utils.Dev)
+		err = w.OpenStorage(ds, password)
+		t.Cleanup(func() { w.Close() })
+		return w, err
+	}
+	if _, err := open("password"); err != ErrWrongPassword {
+		t.Fatalf("old password got %v", err)
+	}
+	w, err = open("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestAccounts(t, w)
+	w.Close()
+	if w, err = open("new"); err != nil {
+		t.Fatal(err)
+	}
+	if w.prevDataKey != nil {
+		t.Fatal("previous data key is kept after every entry is sealed again")
+	}
+	checkTestAccounts(t, w)
+}
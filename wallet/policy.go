@@ -0,0 +1,309 @@
+package wallet
+
+import (
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/kataras/go-errors"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// PolicyRule is a rule of SpendingPolicy
+type PolicyRule int
+
+const (
+	// operation type is in ForbiddenOperations
+	RuleForbiddenOperation PolicyRule = iota
+	// recipient is in DeniedRecipients
+	RuleDeniedRecipient
+	// AllowedRecipients is set, and recipient is not in it
+	RuleRecipientNotAllowed
+	// amount of an operation is more than MaxTransfer
+	RuleMaxTransfer
+	// amount of the transaction and amount spent today are more than DailyLimit
+	RuleDailyLimit
+)
+
+func (rule PolicyRule) String() string {
+	switch rule {
+	case RuleForbiddenOperation:
+		return "forbidden operation"
+	case RuleDeniedRecipient:
+		return "denied recipient"
+	case RuleRecipientNotAllowed:
+		return "recipient not allowed"
+	case RuleMaxTransfer:
+		return "max transfer"
+	case RuleDailyLimit:
+		return "daily limit"
+	}
+	return "unknown"
+}
+
+// PolicyError is returned when operations of an account violate its spending policy, they are not signed
+type PolicyError struct {
+	Name      string
+	Rule      PolicyRule
+	Operation string // Account method name of the operation, e.g. "Transfer"
+	Recipient string // set for recipient rules
+	Amount    uint64 // amount of the operation, or total amount of the transaction for RuleDailyLimit
+	Limit     uint64 // set for amount rules
+	Spent     uint64 // amount spent today before the transaction, set for RuleDailyLimit
+}
+
+func (e *PolicyError) Error() string {
+	switch e.Rule {
+	case RuleForbiddenOperation:
+		return fmt.Sprintf("policy of account %s forbids operation %s", e.Name, e.Operation)
+	case RuleDeniedRecipient, RuleRecipientNotAllowed:
+		return fmt.Sprintf("policy of account %s: %s %s of operation %s", e.Name, e.Rule, e.Recipient, e.Operation)
+	case RuleMaxTransfer:
+		return fmt.Sprintf("policy of account %s: %s exceeded by operation %s, amount: %d, limit: %d", e.Name, e.Rule, e.Operation, e.Amount, e.Limit)
+	case RuleDailyLimit:
+		return fmt.Sprintf("policy of account %s: %s exceeded, amount: %d, spent today: %d, limit: %d", e.Name, e.Rule, e.Amount, e.Spent, e.Limit)
+	}
+	return fmt.Sprintf("policy of account %s violated", e.Name)
+}
+
+// SpendingPolicy limits what an account can sign, it's checked by every operation of the account before signing
+// amounts are COS moved to a recipient by Transfer, TransferToVest, Stake, ContractApply and the fee of CreateAccount
+// recipients are also checked for DelegateVest, whose amount is vest and isn't counted
+type SpendingPolicy struct {
+	DailyLimit          uint64   `json:"daily_limit,omitempty"`          // max total amount per UTC day, 0 means no limit
+	MaxTransfer         uint64   `json:"max_transfer,omitempty"`         // max amount of an operation, 0 means no limit
+	AllowedRecipients   []string `json:"allowed_recipients,omitempty"`   // if not empty, only these accounts can be recipients
+	DeniedRecipients    []string `json:"denied_recipients,omitempty"`    // these accounts can't be recipients
+	ForbiddenOperations []string `json:"forbidden_operations,omitempty"` // Account method names, e.g. "ContractDeploy", "BpRegist"
+}
+
+// SpendingTally is the amount an account spent on a day, it's counted once a policy is set
+type SpendingTally struct {
+	Day   int64  `json:"day"` // days since unix epoch, UTC
+	Spent uint64 `json:"spent"`
+}
+
+// Account method names of operations
+var operationNames = map[reflect.Type]string{
+	reflect.TypeOf(&prototype.AccountCreateOperation{}):  "CreateAccount",
+	reflect.TypeOf(&prototype.AccountUpdateOperation{}):  "AccountUpdate",
+	reflect.TypeOf(&prototype.TransferOperation{}):       "Transfer",
+	reflect.TypeOf(&prototype.TransferToVestOperation{}): "TransferToVest",
+	reflect.TypeOf(&prototype.VoteOperation{}):           "Vote",
+	reflect.TypeOf(&prototype.BpRegisterOperation{}):     "BpRegist",
+	reflect.TypeOf(&prototype.BpUpdateOperation{}):       "BpUpdate",
+	reflect.TypeOf(&prototype.BpEnableOperation{}):       "BpEnable",
+	reflect.TypeOf(&prototype.BpVoteOperation{}):         "BpVote",
+	reflect.TypeOf(&prototype.FollowOperation{}):         "Follow",
+	reflect.TypeOf(&prototype.ContractDeployOperation{}): "ContractDeploy",
+	reflect.TypeOf(&prototype.ContractApplyOperation{}):  "ContractApply",
+	reflect.TypeOf(&prototype.PostOperation{}):           "Post",
+	reflect.TypeOf(&prototype.ReplyOperation{}):          "Reply",
+	reflect.TypeOf(&prototype.ConvertVestOperation{}):    "ConvertVest",
+	reflect.TypeOf(&prototype.StakeOperation{}):          "Stake",
+	reflect.TypeOf(&prototype.UnStakeOperation{}):        "UnStake",
+	reflect.TypeOf(&prototype.AcquireTicketOperation{}):  "AcquireTicket",
+	reflect.TypeOf(&prototype.VoteByTicketOperation{}):   "VoteByTicket",
+	reflect.TypeOf(&prototype.DelegateVestOperation{}):   "DelegateVest",
+	reflect.TypeOf(&prototype.UnDelegateVestOperation{}): "UnDelegateVest",
+}
+
+// return names of operations that can be forbidden by a policy, sorted
+func PolicyOperations() []string {
+	names := make([]string, 0, len(operationNames))
+	for _, name := range operationNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// return the Account method name of an operation, or its type name if it's unknown
+func operationName(op interface{}) string {
+	if name, ok := operationNames[reflect.TypeOf(op)]; ok {
+		return name
+	}
+	return fmt.Sprintf("%T", op)
+}
+
+// return recipient and COS amount of an operation, ok is false if it has no recipient
+func operationFlow(op interface{}) (to string, amount uint64, ok bool) {
+	switch o := op.(type) {
+	case *prototype.TransferOperation:
+		return o.To.GetValue(), o.Amount.GetValue(), true
+	case *prototype.TransferToVestOperation:
+		return o.To.GetValue(), o.Amount.GetValue(), true
+	case *prototype.StakeOperation:
+		return o.To.GetValue(), o.Amount.GetValue(), true
+	case *prototype.ContractApplyOperation:
+		return o.Owner.GetValue(), o.Amount.GetValue(), true
+	case *prototype.AccountCreateOperation:
+		return o.NewAccountName.GetValue(), o.Fee.GetValue(), true
+	case *prototype.DelegateVestOperation:
+		return o.To.GetValue(), 0, true
+	}
+	return "", 0, false
+}
+
+// check the policy is valid, e.g. forbidden operations are known
+func (p *SpendingPolicy) Validate() error {
+	known := make(map[string]bool, len(operationNames))
+	for _, name := range operationNames {
+		known[name] = true
+	}
+	for _, name := range p.ForbiddenOperations {
+		if !known[name] {
+			return errors.New("unknown operation in spending policy: " + name)
+		}
+	}
+	return nil
+}
+
+// check operations of account name, spent is the amount spent today
+// return total amount of operations, or a *PolicyError
+func (p *SpendingPolicy) Check(name string, spent uint64, ops []interface{}) (uint64, error) {
+	var total uint64
+	for _, op := range ops {
+		opName := operationName(op)
+		if containsString(p.ForbiddenOperations, opName) {
+			return 0, &PolicyError{Name: name, Rule: RuleForbiddenOperation, Operation: opName}
+		}
+		to, amount, ok := operationFlow(op)
+		if !ok {
+			continue
+		}
+		if containsString(p.DeniedRecipients, to) {
+			return 0, &PolicyError{Name: name, Rule: RuleDeniedRecipient, Operation: opName, Recipient: to}
+		}
+		if len(p.AllowedRecipients) > 0 && !containsString(p.AllowedRecipients, to) {
+			return 0, &PolicyError{Name: name, Rule: RuleRecipientNotAllowed, Operation: opName, Recipient: to}
+		}
+		if p.MaxTransfer > 0 && amount > p.MaxTransfer {
+			return 0, &PolicyError{Name: name, Rule: RuleMaxTransfer, Operation: opName, Amount: amount, Limit: p.MaxTransfer}
+		}
+		if total += amount; total < amount {
+			total = math.MaxUint64
+		}
+	}
+	if p.DailyLimit > 0 && (spent > p.DailyLimit || total > p.DailyLimit-spent) {
+		return 0, &PolicyError{Name: name, Rule: RuleDailyLimit, Amount: total, Limit: p.DailyLimit, Spent: spent}
+	}
+	return total, nil
+}
+
+// return a deep copy of policy
+func (p *SpendingPolicy) Copy() *SpendingPolicy {
+	c := *p
+	c.AllowedRecipients = append([]string(nil), p.AllowedRecipients...)
+	c.DeniedRecipients = append([]string(nil), p.DeniedRecipients...)
+	c.ForbiddenOperations = append([]string(nil), p.ForbiddenOperations...)
+	return &c
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// return current UTC day of tallies
+func today() int64 {
+	return time.Now().Unix() / int64(24*time.Hour/time.Second)
+}
+
+// return amount spent today, 0 if the tally is of another day
+func (r *Record) spentToday() uint64 {
+	if r.Spending == nil || r.Spending.Day != today() {
+		return 0
+	}
+	return r.Spending.Spent
+}
+
+// keep policy and tally of an account being added again
+func keepPolicy(r, old *Record) {
+	if r.Policy == nil && old.Policy != nil {
+		r.Policy = old.Policy.Copy()
+	}
+	if r.Spending == nil && old.Spending != nil {
+		spending := *old.Spending
+		r.Spending = &spending
+	}
+}
+
+// return a copy of spending policy of an account, nil if it has none
+func (w *BaseWallet) GetPolicy(name string) *SpendingPolicy {
+	r := w.GetRecord(name)
+	if r == nil || r.Policy == nil {
+		return nil
+	}
+	return r.Policy
+}
+
+// return amount an account spent today, counted since a policy is set
+func (w *BaseWallet) SpentToday(name string) uint64 {
+	r := w.GetRecord(name)
+	if r == nil {
+		return 0
+	}
+	return r.spentToday()
+}
+
+// the CheckOperations callback of accounts in wallet
+// amount of operations is added to the tally before signing, so concurrent operations can't exceed the daily limit,
+// and taken back if the transaction is known not to be applied
+func (w *BaseWallet) checkPolicy(name string, ops []interface{}) (func(applied bool), error) {
+	if w.GetPolicy(name) == nil {
+		return nil, nil
+	}
+	var amount uint64
+	day := today()
+	err := w.store.updateRecord(name, func(r *Record) error {
+		if r.Policy == nil {
+			return nil
+		}
+		spent := r.spentToday()
+		total, err := r.Policy.Check(name, spent, ops)
+		if err != nil {
+			return err
+		}
+		amount = total
+		if spent += total; spent < total {
+			spent = math.MaxUint64
+		}
+		r.Spending = &SpendingTally{Day: day, Spent: spent}
+		return nil
+	})
+	if err != nil || amount == 0 {
+		return nil, err
+	}
+	return func(applied bool) {
+		if applied {
+			return
+		}
+		// the tally stays if it can't be saved, e.g. the wallet is locked meanwhile, it's on the safe side
+		w.store.updateRecord(name, func(r *Record) error {
+			if r.Spending != nil && r.Spending.Day == day && r.Spending.Spent >= amount {
+				r.Spending.Spent -= amount
+			}
+			return nil
+		})
+	}, nil
+}
+
+// set spending policy of an account, nil removes it. for a keystore wallet, the policy and tally are saved in keystore
+func (w *BaseWallet) SetPolicy(name string, p *SpendingPolicy) error {
+	if p != nil {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		p = p.Copy()
+	}
+	return w.store.updateRecord(name, func(r *Record) error {
+		r.Policy = p
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"testing"
+)
+
+func transferOp(to string, amount uint64) *prototype.TransferOperation {
+	return &prototype.TransferOperation{
+		From:   &prototype.AccountName{Value: "alice1"},
+		To:     &prototype.AccountName{Value: to},
+		Amount: prototype.NewCoin(amount),
+	}
+}
+
+func TestSpendingPolicyCheck(t *testing.T) {
+	p := &SpendingPolicy{
+		DailyLimit:          100,
+		MaxTransfer:         60,
+		DeniedRecipients:    []string{"mallory"},
+		ForbiddenOperations: []string{"ContractDeploy"},
+	}
+	tests := []struct {
+		spent uint64
+		ops   []interface{}
+		total uint64
+		rule  PolicyRule
+		ok    bool
+	}{
+		{0, []interface{}{transferOp("bobby1", 50), transferOp("carol1", 40)}, 90, 0, true},
+		{50, []interface{}{transferOp("bobby1", 50)}, 50, 0, true},
+		{50, []interface{}{transferOp("bobby1", 51)}, 0, RuleDailyLimit, false},
+		{100, []interface{}{&prototype.FollowOperation{}}, 0, 0, true},
+		{0, []interface{}{transferOp("bobby1", 61)}, 0, RuleMaxTransfer, false},
+		{0, []interface{}{transferOp("mallory", 1)}, 0, RuleDeniedRecipient, false},
+		{0, []interface{}{&prototype.ContractDeployOperation{}}, 0, RuleForbiddenOperation, false},
+	}
+	for i, test := range tests {
+		total, err := p.Check("alice1", test.spent, test.ops)
+		if test.ok {
+			if err != nil || total != test.total {
+				t.Fatalf("case %d: got total %d, error %v", i, total, err)
+			}
+			continue
+		}
+		if perr, ok := err.(*PolicyError); !ok || perr.Rule != test.rule {
+			t.Fatalf("case %d: got error %v, want rule %s", i, err, test.rule)
+		}
+	}
+
+	allowed := &SpendingPolicy{AllowedRecipients: []string{"bobby1"}}
+	if _, err := allowed.Check("alice1", 0, []interface{}{transferOp("carol1", 1)}); err == nil {
+		t.Fatal("recipient not allowed is accepted")
+	}
+	if err := (&SpendingPolicy{ForbiddenOperations: []string{"Teleport"}}).Validate(); err == nil {
+		t.Fatal("unknown operation is accepted")
+	}
+}
+
+func TestPolicyTally(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := NewMemWallet(startNode(t, node), utils.Dev)
+	defer w.Close()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetPolicy("alice1", &SpendingPolicy{DailyLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+	acc := w.Account("alice1")
+
+	if _, err := acc.Transfer("bobby1", 60, ""); err != nil {
+		t.Fatal(err)
+	}
+	if spent := w.SpentToday("alice1"); spent != 60 {
+		t.Fatalf("spent %d after a transfer, want 60", spent)
+	}
+	// refused by policy, never signed
+	if _, err := acc.Transfer("bobby1", 50, ""); err == nil {
+		t.Fatal("transfer over daily limit is signed")
+	}
+	if n := node.trxCount(); n != 1 {
+		t.Fatalf("%d transactions broadcast, want 1", n)
+	}
+	// rejected by the chain, the amount is taken back
+	node.setStatus(prototype.StatusError)
+	if _, err := acc.Transfer("bobby1", 40, ""); err != nil {
+		t.Fatal(err)
+	}
+	if spent := w.SpentToday("alice1"); spent != 60 {
+		t.Fatalf("spent %d after a rejected transfer, want 60", spent)
+	}
+
+	// the tally is kept when the account is added again
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if spent := w.SpentToday("alice1"); spent != 60 || w.GetPolicy("alice1") == nil {
+		t.Fatalf("policy %+v, spent %d after adding again", w.GetPolicy("alice1"), spent)
+	}
+}
+
+func TestPolicyForbidsRotation(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := NewMemWallet(startNode(t, node), utils.Dev)
+	defer w.Close()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetPolicy("alice1", &SpendingPolicy{ForbiddenOperations: []string{"AccountUpdate"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := w.RotateKey("alice1", &RotateOptions{NewKey: testKey2})
+	if perr, ok := err.(*PolicyError); !ok || perr.Rule != RuleForbiddenOperation {
+		t.Fatalf("rotation got %v", err)
+	}
+	if node.key("alice1") != testPubKey {
+		t.Fatal("forbidden rotation is broadcast")
+	}
+}
@@ -0,0 +1,257 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+	"time"
+)
+
+// A keystore of version 4 (KeyStoreVersionStorage) is kept in a Storage as a header and one entry per account or contact.
+//
+// The header is EncryptKeyStore in json, binary fields are base64:
+//
+//	{
+//	  "Version": 4,
+//	  "CipherText": "...",  aes-256-gcm encrypted keyStoreKeys json
+//	  "Iv": "...",          gcm nonce of CipherText, 12 bytes
+//	  "Mac": "...",         hmac-sha256 of "cos-sdk-go keystore password check" by the mac key
+//	  "Kdf": "scrypt",
+//	  "KdfParams": {"N": 262144, "R": 8, "P": 1},
+//	  "Salt": "..."         32 bytes
+//	}
+//
+// scrypt(password, Salt, KdfParams) derives 64 bytes, the first half encrypts the payload and the second half is the mac key.
+// the payload is sealed with the header json as associated data, with CipherText and Iv empty, so other fields can't be changed.
+// it has the data key, 32 random bytes, and the sequence number of every entry and of the last write:
+//
+//	{"data_key": "...", "counter": 12, "manifest": {"alice": 3, "#contact/bob": 12}}
+//
+// An entry is saved under the account name, or "#contact/" + name for a contact, its value is
+//
+//	sequence number (8 bytes, big endian) | gcm nonce (12 bytes) | aes-256-gcm(data key, json, associated data)
+//
+// the associated data is the entry name followed by the sequence number, so an entry can't be moved to another name,
+// and one rolled back to an older version, or deleted, doesn't match the manifest.
+// the json of an account is Record with a "version" field, see RecordVersion, and of a contact is Contact.
+// a FileStorage keeps all of them in one json file: {"Version": 4, "Header": {...}, "Records": {"name": "base64 entry"}}
+
+// version of a record in storage, increase it when a change of Record can't be read by older versions
+// 2 adds rotation, archived keys, policy and spending. records saved before it have no version, they are read as 1
+const RecordVersion = 2
+
+// a record in storage, it's the json of Record with its version
+type storedRecord struct {
+	Version int `json:"version"`
+	*Record
+}
+
+// version of KeyStoreContent
+const KeyStoreContentVersion = 1
+
+// KeyStoreContent is the decrypted payload of a keystore of version 3 (KeyStoreVersionJSON), it's only read for migration
+//
+//	{"version": 1, "accounts": [{"name": "alice", "private_key": "3diU...", ...}]}
+type KeyStoreContent struct {
+	Version  int       `json:"version"`
+	Accounts []*Record `json:"accounts"`
+}
+
+// sources of records
+const (
+	SourcePrivateKey  = "private_key"
+	SourceMnemonic    = "mnemonic"
+	SourceCliKeyFile  = "cli_key_file"
+	SourcePaperKey    = "paper_key"
+	SourceHexKey      = "hex_key"
+	SourcePEM         = "pem"
+	SourceEthKeyStore = "eth_keystore"
+)
+
+// Record is everything a wallet stores for an account
+type Record struct {
+	Name           string `json:"name"`
+	PrivateKey     string `json:"private_key"`          // WIF, empty for watch-only accounts
+	PublicKey      string `json:"public_key,omitempty"` // WIF, derived from private key, or given for watch-only accounts
+	Metadata              // labels, notes and tags, changed by SetMetadata
+	DerivationPath string `json:"derivation_path,omitempty"` // set if key is derived from a mnemonic
+	Source         string `json:"source,omitempty"`          // how the key is added, one of Source*, empty if unknown
+	CreatedTime    int64  `json:"created_time,omitempty"`    // unix seconds, when the account is added to wallet
+	WatchOnly      bool   `json:"watch_only,omitempty"`      // account is tracked without private key, it can't sign
+	// set while a new key is being rotated in, see RotateKey
+	Rotation *KeyRotation `json:"rotation,omitempty"`
+	// keys replaced by rotations, oldest first
+	ArchivedKeys []*ArchivedKey `json:"archived_keys,omitempty"`
+	// checked by every operation of the account before signing, see SetPolicy
+	Policy *SpendingPolicy `json:"policy,omitempty"`
+	// amount spent today, counted while a policy is set
+	Spending *SpendingTally `json:"spending,omitempty"`
+}
+
+// KeyRotation is a new key staged in wallet, it becomes active once the AccountUpdate transaction is irreversible
+type KeyRotation struct {
+	PrivateKey  string `json:"private_key"` // WIF
+	PublicKey   string `json:"public_key"`  // WIF
+	TrxId       string `json:"trx_id"`      // hex id of the AccountUpdate transaction
+	Expiration  int64  `json:"expiration"`  // unix seconds, the transaction can't be applied after it
+	StartedTime int64  `json:"started_time"`
+}
+
+// ArchivedKey is a key of an account before it's rotated
+type ArchivedKey struct {
+	PrivateKey  string `json:"private_key"` // WIF
+	PublicKey   string `json:"public_key"`  // WIF
+	RetiredTime int64  `json:"retired_time"`
+	// staged by a rotation judged failed, it's kept in case the transaction is applied later, see HealthArchivedKey
+	Failed bool `json:"failed,omitempty"`
+}
+
+// create a record of an account added now
+func NewRecord(name, privateKey string) *Record {
+	r := &Record{
+		Name:        name,
+		PrivateKey:  privateKey,
+		Source:      SourcePrivateKey,
+		CreatedTime: time.Now().Unix(),
+	}
+	if privKey, err := prototype.PrivateKeyFromWIF(privateKey); err == nil {
+		if pubKey, err := privKey.PubKey(); err == nil {
+			r.PublicKey = pubKey.ToWIF()
+		}
+	}
+	return r
+}
+
+// return a deep copy of record
+func (r *Record) Copy() *Record {
+	c := *r
+	c.Metadata = r.Metadata.copy()
+	if r.Rotation != nil {
+		rotation := *r.Rotation
+		c.Rotation = &rotation
+	}
+	if r.ArchivedKeys != nil {
+		c.ArchivedKeys = make([]*ArchivedKey, len(r.ArchivedKeys))
+		for i, k := range r.ArchivedKeys {
+			key := *k
+			c.ArchivedKeys[i] = &key
+		}
+	}
+	if r.Policy != nil {
+		c.Policy = r.Policy.Copy()
+	}
+	if r.Spending != nil {
+		spending := *r.Spending
+		c.Spending = &spending
+	}
+	return &c
+}
+
+// forget all private keys in record, including staged and archived ones
+func (r *Record) clearPrivateKeys() {
+	r.PrivateKey = ""
+	if r.Rotation != nil {
+		r.Rotation.PrivateKey = ""
+	}
+	for _, k := range r.ArchivedKeys {
+		k.PrivateKey = ""
+	}
+}
+
+// encrypt a record by the data key of keystore as an entry of sequence number seq
+// its name is authenticated, so it can't be moved to another name
+func sealRecord(dataKey []byte, r *Record, seq uint64) ([]byte, error) {
+	return sealJSON(dataKey, r.Name, seq, &storedRecord{Version: RecordVersion, Record: r})
+}
+
+// decrypt a record saved under name, return it with the sequence number of its entry
+func openRecord(dataKey []byte, name string, data []byte) (*Record, uint64, error) {
+	stored := storedRecord{Record: &Record{}}
+	seq, err := openJSON(dataKey, name, data, &stored)
+	if err != nil || stored.Name != name {
+		return nil, 0, ErrKeyStoreCorrupted
+	}
+	if stored.Version > RecordVersion {
+		return nil, 0, errors.New(fmt.Sprintf("unsupported version %d of record %s", stored.Version, name))
+	}
+	return stored.Record, seq, nil
+}
+
+// encrypt json of v by the data key of keystore, saved under key in storage as an entry of sequence number seq
+func sealJSON(dataKey []byte, key string, seq uint64, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.ZeroBytes(data)
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, seq)
+	cipherData, nonce, err := utils.SealData(data, dataKey, entryData(key, prefix))
+	if err != nil {
+		return nil, err
+	}
+	return append(append(prefix, nonce...), cipherData...), nil
+}
+
+// decrypt an entry saved under key to v, return its sequence number
+func openJSON(dataKey []byte, key string, data []byte, v interface{}) (uint64, error) {
+	if len(data) < 8+utils.NonceLength {
+		return 0, ErrKeyStoreCorrupted
+	}
+	prefix, nonce := data[:8], data[8:8+utils.NonceLength]
+	plain, err := utils.OpenData(data[8+utils.NonceLength:], dataKey, nonce, entryData(key, prefix))
+	if err != nil {
+		return 0, ErrKeyStoreCorrupted
+	}
+	defer utils.ZeroBytes(plain)
+	if err := json.Unmarshal(plain, v); err != nil {
+		return 0, ErrKeyStoreCorrupted
+	}
+	return binary.BigEndian.Uint64(prefix), nil
+}
+
+// associated data of an entry, its name followed by its sequence number
+func entryData(key string, seq []byte) []byte {
+	return append([]byte(key), seq...)
+}
+
+// decode records from keystore payload
+func decodeContent(data []byte) (map[string]*Record, error) {
+	var content KeyStoreContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	if content.Version > KeyStoreContentVersion {
+		return nil, errors.New(fmt.Sprintf("unsupported keystore content version %d", content.Version))
+	}
+	records := make(map[string]*Record, len(content.Accounts))
+	for _, r := range content.Accounts {
+		if r == nil || r.Name == "" {
+			return nil, ErrKeyStoreCorrupted
+		}
+		records[r.Name] = r
+	}
+	return records, nil
+}
+
+// an account in a legacy gob payload, gob matches fields by name
+type legacyAccount struct {
+	Name       string
+	PrivateKey string
+}
+
+// convert accounts decoded from a legacy gob payload
+func migrateAccounts(accounts map[string]*legacyAccount) map[string]*Record {
+	records := make(map[string]*Record, len(accounts))
+	for name, acc := range accounts {
+		r := NewRecord(name, acc.PrivateKey)
+		// unknown for legacy accounts
+		r.Source = ""
+		r.CreatedTime = 0
+		records[name] = r
+	}
+	return records
+}
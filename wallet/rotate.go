@@ -0,0 +1,309 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/rpcclient"
+	"github.com/coschain/cos-sdk-go/utils"
+	"github.com/kataras/go-errors"
+	"time"
+)
+
+// how long RotateKey and ResumeRotation wait for the transaction to be irreversible by default
+const DefaultRotationTimeout = 3 * time.Minute
+
+const rotationPollInterval = time.Second
+
+var (
+	ErrRotationInProgress = errors.New("account has a pending key rotation, call ResumeRotation")
+	ErrRotationPending    = errors.New("key rotation is not irreversible yet, call ResumeRotation later")
+	ErrRotationFailed     = errors.New("key rotation transaction is not applied, the new key is archived as failed")
+	ErrNoRotation         = errors.New("account has no pending key rotation")
+)
+
+// RotateOptions are optional parameters of RotateKey
+type RotateOptions struct {
+	NewKey  string        // WIF private key to rotate to, a new key is generated if empty
+	Timeout time.Duration // DefaultRotationTimeout if 0
+}
+
+// replace the key of an account on chain and in wallet
+//
+//  1. the AccountUpdate transaction is signed by current key, no lock of wallet is held meanwhile
+//  2. the new key and the transaction id are staged in record, if the account still has the key that signed
+//  3. the transaction is broadcast, the new key is archived as failed if it's rejected
+//  4. once the transaction is irreversible, the new key becomes active, and current key is archived in record
+//
+// if the transaction can't be confirmed in time, e.g. a network failure, the new key stays staged and
+// ErrRotationPending is returned, call ResumeRotation to finish it. current key signs until the rotation finishes
+// return the new public key
+func (w *BaseWallet) RotateKey(name string, opts *RotateOptions) (string, error) {
+	if opts == nil {
+		opts = &RotateOptions{}
+	}
+	newKey := opts.NewKey
+	if newKey == "" {
+		_, pri, err := w.GenerateNewKeyPair()
+		if err != nil {
+			return "", err
+		}
+		newKey = pri
+	}
+	privKey, err := prototype.PrivateKeyFromWIF(newKey)
+	if err != nil {
+		return "", ErrInvalidPrivateKey
+	}
+	pubKey, err := privKey.PubKey()
+	if err != nil {
+		return "", ErrInvalidPrivateKey
+	}
+
+	r := w.record(name)
+	switch {
+	case r == nil:
+		return "", errors.New("account not in wallet: " + name)
+	case r.WatchOnly:
+		return "", ErrWatchOnly
+	case r.Rotation != nil:
+		return "", ErrRotationInProgress
+	// private keys are cleared when a keystore wallet is locked
+	case r.PrivateKey == "":
+		return "", ErrWalletLocked
+	case r.PublicKey == pubKey.ToWIF():
+		return "", errors.New("new key is the current key of account: " + name)
+	}
+	signer := r.PrivateKey
+	op := &prototype.AccountUpdateOperation{
+		Owner:  &prototype.AccountName{Value: name},
+		PubKey: pubKey,
+	}
+	// checked by the policy like operations signed by accounts, e.g. "AccountUpdate" may be forbidden
+	// it moves no amount, so nothing is reserved
+	if _, err := w.checkPolicy(name, []interface{}{op}); err != nil {
+		return "", err
+	}
+	// it queries the chain, so it's not done under a lock of wallet
+	signTx, err := utils.GenerateSignedTxAndValidate(rpcclient.GetRpc(), signer, string(w.chainId), op)
+	if err != nil {
+		return "", err
+	}
+	id, err := signTx.Id()
+	if err != nil {
+		return "", err
+	}
+	trxId := hex.EncodeToString(id.Hash)
+
+	// stage new key with the signed transaction, so it's never lost once broadcast
+	err = w.store.updateRecord(name, func(r *Record) error {
+		if r.Rotation != nil {
+			return ErrRotationInProgress
+		}
+		if r.PrivateKey != signer {
+			return errors.New("key of account is changed during rotation: " + name)
+		}
+		r.Rotation = &KeyRotation{
+			PrivateKey:  newKey,
+			PublicKey:   pubKey.ToWIF(),
+			TrxId:       trxId,
+			Expiration:  int64(signTx.Trx.Expiration.UtcSeconds),
+			StartedTime: time.Now().Unix(),
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res, err := rpcclient.GetRpc().BroadcastTrx(context.Background(), &grpcpb.BroadcastTrxRequest{Transaction: signTx})
+	if err == nil {
+		var receipt *utils.Receipt
+		if receipt, err = utils.NewReceipt(res); err == nil && receipt.Status != prototype.StatusSuccess {
+			err = &utils.TrxError{Status: receipt.Status, Msg: receipt.ErrorInfo}
+		}
+	}
+	if _, rejected := err.(*utils.TrxError); rejected {
+		if rerr := w.failRotation(name, trxId); rerr != nil {
+			return "", rerr
+		}
+		return "", err
+	}
+	// delivered or unknown, it's confirmed by the chain state
+	return pubKey.ToWIF(), w.ResumeRotation(name, opts.Timeout)
+}
+
+// finish a key rotation left by RotateKey, e.g. after ErrRotationPending or a crash, by the chain state
+// the new key is activated or archived as failed, a keystore wallet must be unlocked to save the result
+// return ErrRotationPending on timeout, ErrRotationFailed if the transaction expired without being applied
+func (w *BaseWallet) ResumeRotation(name string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultRotationTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		r := w.record(name)
+		if r == nil {
+			return errors.New("account not in wallet: " + name)
+		}
+		if r.Rotation == nil {
+			return ErrNoRotation
+		}
+		done, err := w.checkRotation(name, r.Rotation)
+		if done || err != nil {
+			return err
+		}
+		if time.Now().Add(rotationPollInterval).After(deadline) {
+			return ErrRotationPending
+		}
+		time.Sleep(rotationPollInterval)
+	}
+}
+
+// check chain state of a staged rotation, activate the new key or archive it as failed if the transaction is settled
+// expiration is compared with the head block time, a node behind the chain delays the decision but doesn't fail it
+func (w *BaseWallet) checkRotation(name string, rotation *KeyRotation) (bool, error) {
+	hash, err := hex.DecodeString(rotation.TrxId)
+	if err != nil {
+		return false, ErrKeyStoreCorrupted
+	}
+	state, err := w.GetChainState()
+	if err != nil {
+		return false, err
+	}
+	if state.State == nil || state.State.Dgpo == nil || state.State.Dgpo.Time == nil {
+		return false, errors.New("chain state has no head block time")
+	}
+	headTime := int64(state.State.Dgpo.Time.UtcSeconds)
+	irreversible, err := w.GetBlkIsIrreversibleByTxId(&prototype.Sha256{Hash: hash})
+	if err != nil {
+		return false, err
+	}
+	res, err := w.GetAccountByName(name)
+	if err != nil {
+		return false, err
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		return false, ErrAccountNotFound
+	}
+	applied := res.Info.PublicKey.ToWIF() == rotation.PublicKey
+	switch {
+	case irreversible.Result && applied:
+		return true, w.activateRotation(name, rotation.TrxId)
+	// irreversible but failed, or expired without being included in a block
+	case irreversible.Result, !applied && headTime > rotation.Expiration:
+		if err := w.failRotation(name, rotation.TrxId); err != nil {
+			return false, err
+		}
+		return true, ErrRotationFailed
+	}
+	return false, nil
+}
+
+// make the staged key active, and archive current key
+func (w *BaseWallet) activateRotation(name, trxId string) error {
+	return w.store.updateRecord(name, func(r *Record) error {
+		if r.Rotation == nil || r.Rotation.TrxId != trxId {
+			return ErrNoRotation
+		}
+		r.ArchivedKeys = append(r.ArchivedKeys, &ArchivedKey{
+			PrivateKey:  r.PrivateKey,
+			PublicKey:   r.PublicKey,
+			RetiredTime: time.Now().Unix(),
+		})
+		r.PrivateKey, r.PublicKey = r.Rotation.PrivateKey, r.Rotation.PublicKey
+		r.Rotation = nil
+		return nil
+	})
+}
+
+// archive the staged key of a failed rotation, it's kept in case the transaction is applied after all
+func (w *BaseWallet) failRotation(name, trxId string) error {
+	return w.store.updateRecord(name, func(r *Record) error {
+		if r.Rotation == nil || r.Rotation.TrxId != trxId {
+			return ErrNoRotation
+		}
+		r.ArchivedKeys = append(r.ArchivedKeys, &ArchivedKey{
+			PrivateKey:  r.Rotation.PrivateKey,
+			PublicKey:   r.Rotation.PublicKey,
+			RetiredTime: time.Now().Unix(),
+			Failed:      true,
+		})
+		r.Rotation = nil
+		return nil
+	})
+}
+
+// keep staged and archived keys of an account being added again, a replacement never drops a key
+// archived keys of r are added after those of old, and so is the key of old if r has another one.
+// the staged key of old stays staged, unless it's the key of r, or r has a staged key itself,
+// then it's archived as failed in case the transaction is applied after all
+func keepRotation(r, old *Record) {
+	archived := make(map[string]bool)
+	var keys []*ArchivedKey
+	add := func(k *ArchivedKey) {
+		if !archived[k.PublicKey] {
+			archived[k.PublicKey] = true
+			key := *k
+			keys = append(keys, &key)
+		}
+	}
+	for _, k := range old.ArchivedKeys {
+		add(k)
+	}
+	for _, k := range r.ArchivedKeys {
+		add(k)
+	}
+	if !old.WatchOnly && old.PublicKey != r.PublicKey {
+		add(&ArchivedKey{PrivateKey: old.PrivateKey, PublicKey: old.PublicKey, RetiredTime: time.Now().Unix()})
+	}
+	if rotation := old.Rotation; rotation != nil && rotation.PublicKey != r.PublicKey {
+		if r.Rotation == nil {
+			staged := *rotation
+			r.Rotation = &staged
+		} else if r.Rotation.PublicKey != rotation.PublicKey {
+			add(&ArchivedKey{
+				PrivateKey:  rotation.PrivateKey,
+				PublicKey:   rotation.PublicKey,
+				RetiredTime: time.Now().Unix(),
+				Failed:      true,
+			})
+		}
+	}
+	r.ArchivedKeys = keys
+}
+
+func (w *MemWallet) updateRecord(name string, f func(r *Record) error) error {
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return ErrWalletClosed
+	}
+	old, ok := w.records[name]
+	if !ok {
+		return errors.New("account not in wallet: " + name)
+	}
+	r := old.Copy()
+	if err := f(r); err != nil {
+		return err
+	}
+	w.setRecord(r)
+	return nil
+}
+
+func (w *KeyStoreWallet) updateRecord(name string, f func(r *Record) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.locked {
+		return ErrWalletLocked
+	}
+	old, ok := w.records[name]
+	if !ok {
+		return errors.New("account not in wallet: " + name)
+	}
+	r := old.Copy()
+	if err := f(r); err != nil {
+		return err
+	}
+	return w.put(r)
+}
@@ -0,0 +1,104 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/cos-sdk-go/utils"
+	"testing"
+)
+
+func TestRotateKey(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := newTestKeyStoreWallet(t, startNode(t, node))
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := w.RotateKey("alice1", &RotateOptions{NewKey: testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubKey != testPubKey2 || node.key("alice1") != testPubKey2 {
+		t.Fatalf("rotated to %s, on chain %s", pubKey, node.key("alice1"))
+	}
+	r := w.GetRecord("alice1")
+	if r.PublicKey != testPubKey2 || r.Rotation != nil || len(r.ArchivedKeys) != 1 || r.ArchivedKeys[0].PublicKey != testPubKey {
+		t.Fatalf("got record %+v", r)
+	}
+	if _, err := w.RotateKey("alice1", &RotateOptions{NewKey: testKey2}); err == nil {
+		t.Fatal("rotated to the current key")
+	}
+}
+
+func TestRotateKeyRejected(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	node.setStatus(prototype.StatusError)
+	w := NewMemWallet(startNode(t, node), utils.Dev)
+	defer w.Close()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.RotateKey("alice1", &RotateOptions{NewKey: testKey2}); err == nil {
+		t.Fatal("rejected rotation succeeded")
+	}
+	// the staged key is archived as failed, never discarded
+	r := w.GetRecord("alice1")
+	if r.PublicKey != testPubKey || r.Rotation != nil || len(r.ArchivedKeys) != 1 {
+		t.Fatalf("got record %+v", r)
+	}
+	if archived := r.ArchivedKeys[0]; archived.PublicKey != testPubKey2 || !archived.Failed {
+		t.Fatalf("got archived key %+v", archived)
+	}
+	if err := w.ResumeRotation("alice1", 0); err != ErrNoRotation {
+		t.Fatalf("resume got %v", err)
+	}
+}
+
+// a staged key and archived keys survive the account being added again and replaced
+func TestReplaceKeepsRotation(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey})
+	w := NewMemWallet(startNode(t, node), utils.Dev, WithOfflineImport())
+	defer w.Close()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	staged := NewRecord("alice1", testKey2)
+	if err := w.store.updateRecord("alice1", func(r *Record) error {
+		r.Rotation = &KeyRotation{PrivateKey: staged.PrivateKey, PublicKey: staged.PublicKey, TrxId: "00"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if r := w.GetRecord("alice1"); r.Rotation == nil || r.Rotation.PublicKey != testPubKey2 {
+		t.Fatalf("add again got record %+v", r)
+	}
+
+	// replaced by another key in a backup, the key replaced is archived
+	_, otherKey, err := w.GenerateNewKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewMemWallet(startNode(t, node), utils.Dev, WithOfflineImport())
+	defer other.Close()
+	if err := other.Add("alice1", otherKey); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := other.ExportBackup("passphrase", &BackupOptions{KdfParams: &utils.KdfParams{N: 1 << 10, R: 8, P: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.RestoreBackup(backup, "passphrase", ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	r := w.GetRecord("alice1")
+	if r.PublicKey != NewRecord("alice1", otherKey).PublicKey || r.Rotation == nil || r.Rotation.PublicKey != testPubKey2 {
+		t.Fatalf("restore got record %+v", r)
+	}
+	if len(r.ArchivedKeys) != 1 || r.ArchivedKeys[0].PublicKey != testPubKey {
+		t.Fatalf("got archived keys %+v", r.ArchivedKeys)
+	}
+	if err := w.ResumeRotation("alice1", 0); err == ErrNoRotation {
+		t.Fatal("rotation is dropped")
+	}
+}
@@ -0,0 +1,204 @@
+package wallet
+
+import (
+	"github.com/kataras/go-errors"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrRecordNotFound = errors.New("record not found in storage")
+)
+
+// Storage persists a keystore as a header and one encrypted record per account
+// it only deals with encrypted data, a record can be saved or deleted without touching others
+type Storage interface {
+	// return the header, nil if storage is empty
+	LoadHeader() ([]byte, error)
+	SaveHeader(header []byte) error
+	// return ErrRecordNotFound if there is no record of name
+	Load(name string) ([]byte, error)
+	Save(name string, data []byte) error
+	// deleting a non-existent record is not an error
+	Delete(name string) error
+	// return sorted names of all records
+	List() ([]string, error)
+	Close() error
+}
+
+// a storage which can read and write many entries at once, e.g. in a single file write or a database batch
+// other storages read and write entries one by one, see loadEntries and saveEntries
+type batchStorage interface {
+	// return all entries by name
+	LoadAll() (map[string][]byte, error)
+	// save entries, or delete those whose data is nil, and header if it's not nil, all at once
+	SaveBatch(entries map[string][]byte, header []byte) error
+}
+
+// read all entries of a storage by name
+func loadEntries(s Storage) (map[string][]byte, error) {
+	if b, ok := s.(batchStorage); ok {
+		return b.LoadAll()
+	}
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := s.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		entries[name] = data
+	}
+	return entries, nil
+}
+
+// save entries of a storage, or delete those whose data is nil, and header if it's not nil
+// unless it's done at once, saved entries are written first, then header, and deleted ones last,
+// so the header never lists an entry not written yet, nor misses one not deleted yet
+func saveEntries(s Storage, entries map[string][]byte, header []byte) error {
+	if b, ok := s.(batchStorage); ok {
+		return b.SaveBatch(entries, header)
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if data := entries[name]; data != nil {
+			if err := s.Save(name, data); err != nil {
+				return err
+			}
+		}
+	}
+	if header != nil {
+		if err := s.SaveHeader(header); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if entries[name] == nil {
+			if err := s.Delete(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// a storage which can keep a copy of current header, called before password is changed
+type headerBackuper interface {
+	BackupHeader() error
+}
+
+// a storage which can keep a copy of a keystore in an earlier version, called before it's migrated
+type legacyBackuper interface {
+	BackupLegacy(version int) error
+}
+
+// MemStorage keeps everything in memory, it's lost after process exits
+type MemStorage struct {
+	mu      sync.Mutex
+	header  []byte
+	backup  []byte
+	records map[string][]byte
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{records: make(map[string][]byte)}
+}
+
+func (s *MemStorage) LoadHeader() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyBytes(s.header), nil
+}
+
+func (s *MemStorage) SaveHeader(header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = copyBytes(header)
+	return nil
+}
+
+func (s *MemStorage) BackupHeader() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backup = copyBytes(s.header)
+	return nil
+}
+
+func (s *MemStorage) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.records[name]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyBytes(data), nil
+}
+
+func (s *MemStorage) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name] = copyBytes(data)
+	return nil
+}
+
+func (s *MemStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, name)
+	return nil
+}
+
+func (s *MemStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.records))
+	for name := range s.records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemStorage) LoadAll() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make(map[string][]byte, len(s.records))
+	for name, data := range s.records {
+		entries[name] = copyBytes(data)
+	}
+	return entries, nil
+}
+
+func (s *MemStorage) SaveBatch(entries map[string][]byte, header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, data := range entries {
+		if data == nil {
+			delete(s.records, name)
+		} else {
+			s.records[name] = copyBytes(data)
+		}
+	}
+	if header != nil {
+		s.header = copyBytes(header)
+	}
+	return nil
+}
+
+func (s *MemStorage) Close() error {
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	dirStorageHeaderFile  = "keystore.json"
+	dirStorageAccountsDir = "accounts"
+	dirStorageLockFile    = ".lock"
+	dirStorageRecordExt   = ".json"
+)
+
+// DirStorage keeps a keystore in a directory, one file per account, so a change only writes one small file
+//
+//	dir/keystore.json          header
+//	dir/accounts/<name>.json   encrypted records
+type DirStorage struct {
+	mu    sync.Mutex
+	dir   string
+	flock *fileLock
+}
+
+// open a keystore directory, it's created if not exist
+// an advisory lock is held until Close, return ErrKeyStoreLocked if it's opened by another storage
+func NewDirStorage(dir string) (*DirStorage, error) {
+	if err := os.MkdirAll(filepath.Join(dir, dirStorageAccountsDir), 0700); err != nil {
+		return nil, err
+	}
+	flock, err := lockFile(filepath.Join(dir, dirStorageLockFile))
+	if err != nil {
+		return nil, err
+	}
+	return &DirStorage{dir: dir, flock: flock}, nil
+}
+
+func (s *DirStorage) Dir() string {
+	return s.dir
+}
+
+// return the file name of the advisory lock
+func (s *DirStorage) LockFileName() string {
+	return filepath.Join(s.dir, dirStorageLockFile)
+}
+
+// return the file name of the backup made by BackupHeader
+func (s *DirStorage) BackupFileName() string {
+	return s.headerFileName() + ".bak"
+}
+
+func (s *DirStorage) LoadHeader() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(s.headerFileName())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *DirStorage) SaveHeader(header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.headerFileName(), header, 0600)
+}
+
+// copy header to keystore.json.bak, records can still be decrypted with it
+func (s *DirStorage) BackupHeader() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.headerFileName()); os.IsNotExist(err) {
+		return nil
+	}
+	return copyFile(s.headerFileName(), s.BackupFileName())
+}
+
+func (s *DirStorage) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(s.recordFileName(name))
+	if os.IsNotExist(err) {
+		return nil, ErrRecordNotFound
+	}
+	return data, err
+}
+
+func (s *DirStorage) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.recordFileName(name), data, 0600)
+}
+
+func (s *DirStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.recordFileName(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Join(s.dir, dirStorageAccountsDir))
+}
+
+func (s *DirStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos, err := ioutil.ReadDir(filepath.Join(s.dir, dirStorageAccountsDir))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		fileName := info.Name()
+		// temp files of unfinished writes start with a dot
+		if info.IsDir() || strings.HasPrefix(fileName, ".") || !strings.HasSuffix(fileName, dirStorageRecordExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(fileName, dirStorageRecordExt))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *DirStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flock != nil {
+		err := s.flock.release()
+		s.flock = nil
+		return err
+	}
+	return nil
+}
+
+func (s *DirStorage) headerFileName() string {
+	return filepath.Join(s.dir, dirStorageHeaderFile)
+}
+
+// account name is escaped, so it's always a plain file name
+func (s *DirStorage) recordFileName(name string) string {
+	escaped := url.PathEscape(name)
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+	return filepath.Join(s.dir, dirStorageAccountsDir, escaped+dirStorageRecordExt)
+}
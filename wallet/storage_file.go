@@ -0,0 +1,263 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// content of a keystore file
+type keyStoreFile struct {
+	Version int
+	Header  json.RawMessage   `json:",omitempty"`
+	Records map[string][]byte `json:",omitempty"`
+}
+
+// FileStorage keeps a whole keystore in a single file, the file is rewritten atomically on every change
+// the parsed file is cached, it's only read again if the file is changed by others since it's read or written,
+// so records changed by others are not overwritten
+type FileStorage struct {
+	mu       sync.Mutex
+	fileName string
+	flock    *fileLock
+	// parsed file and its stat when it's read or written
+	cache     *keyStoreFile
+	cacheInfo os.FileInfo
+}
+
+// open a keystore file, an advisory lock is held until Close
+// return ErrKeyStoreLocked if the file is opened by another storage
+func NewFileStorage(fileName string) (*FileStorage, error) {
+	s := &FileStorage{fileName: fileName}
+	flock, err := lockFile(s.LockFileName())
+	if err != nil {
+		return nil, err
+	}
+	s.flock = flock
+	return s, nil
+}
+
+func (s *FileStorage) FileName() string {
+	return s.fileName
+}
+
+// return the file name of the advisory lock
+func (s *FileStorage) LockFileName() string {
+	return s.fileName + ".lock"
+}
+
+// return the file name of the backup made by BackupHeader
+func (s *FileStorage) BackupFileName() string {
+	return s.fileName + ".bak"
+}
+
+// return the file name of the copy made by BackupLegacy before a keystore of version is migrated
+func (s *FileStorage) LegacyBackupFileName(version int) string {
+	return fmt.Sprintf("%s.v%d.bak", s.fileName, version)
+}
+
+// copy a keystore file in an earlier version before it's migrated, an existing copy is kept
+// so the original file is never lost, even if a migration is interrupted and redone
+func (s *FileStorage) BackupLegacy(version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(s.fileName)
+	if err != nil {
+		return err
+	}
+	err = writeFileExclusive(s.LegacyBackupFileName(version), data, 0600)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStorage) LoadHeader() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return f.Header, nil
+}
+
+func (s *FileStorage) SaveHeader(header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	f.Header = header
+	return s.write(f)
+}
+
+// copy the whole file, records in it can still be decrypted with the backup header
+func (s *FileStorage) BackupHeader() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.fileName); os.IsNotExist(err) {
+		return nil
+	}
+	return copyFile(s.fileName, s.BackupFileName())
+}
+
+func (s *FileStorage) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := f.Records[name]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return data, nil
+}
+
+func (s *FileStorage) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	f.Records[name] = data
+	return s.write(f)
+}
+
+func (s *FileStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.Records[name]; !ok {
+		return nil
+	}
+	delete(f.Records, name)
+	return s.write(f)
+}
+
+func (s *FileStorage) LoadAll() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string][]byte, len(f.Records))
+	for name, data := range f.Records {
+		entries[name] = data
+	}
+	return entries, nil
+}
+
+// the file is written once with all changes
+func (s *FileStorage) SaveBatch(entries map[string][]byte, header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	for name, data := range entries {
+		if data == nil {
+			delete(f.Records, name)
+		} else {
+			f.Records[name] = data
+		}
+	}
+	if header != nil {
+		f.Header = header
+	}
+	return s.write(f)
+}
+
+func (s *FileStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.Records))
+	for name := range f.Records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flock != nil {
+		err := s.flock.release()
+		s.flock = nil
+		return err
+	}
+	return nil
+}
+
+// return the parsed file, which is changed by caller and written by write
+func (s *FileStorage) read() (*keyStoreFile, error) {
+	info, err := os.Stat(s.fileName)
+	if os.IsNotExist(err) {
+		s.cache, s.cacheInfo = nil, nil
+		return &keyStoreFile{Records: make(map[string][]byte)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.cache != nil && sameFileInfo(s.cacheInfo, info) {
+		return s.cache, nil
+	}
+	s.cache, s.cacheInfo = nil, nil
+	data, err := ioutil.ReadFile(s.fileName)
+	if err != nil {
+		return nil, err
+	}
+	f := &keyStoreFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, ErrKeyStoreCorrupted
+	}
+	// files of earlier versions are a single header with all accounts encrypted in it
+	if f.Version < KeyStoreVersionStorage {
+		f.Header = data
+		f.Records = make(map[string][]byte)
+	}
+	if f.Records == nil {
+		f.Records = make(map[string][]byte)
+	}
+	s.cache, s.cacheInfo = f, info
+	return f, nil
+}
+
+func (s *FileStorage) write(f *keyStoreFile) error {
+	// f may be the cache changed by caller, it's read again if anything fails
+	s.cache, s.cacheInfo = nil, nil
+	f.Version = KeyStoreVersionStorage
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.fileName, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.fileName); err == nil {
+		s.cache, s.cacheInfo = f, info
+	}
+	return nil
+}
+
+// whether a file is unchanged, a file replaced by rename is another file
+func sameFileInfo(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"sync"
+)
+
+var (
+	levelDBHeaderKey       = []byte("header")
+	levelDBHeaderBackupKey = []byte("header.bak")
+	levelDBRecordPrefix    = []byte("record/")
+)
+
+// LevelDBStorage keeps a keystore in an embedded leveldb database, suitable for wallets with lots of accounts
+type LevelDBStorage struct {
+	mu sync.Mutex
+	db *leveldb.DB
+}
+
+// open a leveldb database in dir, it's created if not exist
+// leveldb locks dir itself, it can't be opened by another storage until Close
+func NewLevelDBStorage(dir string) (*LevelDBStorage, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStorage{db: db}, nil
+}
+
+func (s *LevelDBStorage) LoadHeader() ([]byte, error) {
+	data, err := s.db.Get(levelDBHeaderKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *LevelDBStorage) SaveHeader(header []byte) error {
+	return s.db.Put(levelDBHeaderKey, header, &opt.WriteOptions{Sync: true})
+}
+
+func (s *LevelDBStorage) BackupHeader() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.db.Get(levelDBHeaderKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.Put(levelDBHeaderBackupKey, data, &opt.WriteOptions{Sync: true})
+}
+
+func (s *LevelDBStorage) Load(name string) ([]byte, error) {
+	data, err := s.db.Get(levelDBRecordKey(name), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrRecordNotFound
+	}
+	return data, err
+}
+
+func (s *LevelDBStorage) Save(name string, data []byte) error {
+	return s.db.Put(levelDBRecordKey(name), data, &opt.WriteOptions{Sync: true})
+}
+
+func (s *LevelDBStorage) Delete(name string) error {
+	return s.db.Delete(levelDBRecordKey(name), &opt.WriteOptions{Sync: true})
+}
+
+func (s *LevelDBStorage) List() ([]string, error) {
+	var names []string
+	it := s.db.NewIterator(util.BytesPrefix(levelDBRecordPrefix), nil)
+	defer it.Release()
+	for it.Next() {
+		names = append(names, string(it.Key()[len(levelDBRecordPrefix):]))
+	}
+	return names, it.Error()
+}
+
+func (s *LevelDBStorage) LoadAll() (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	it := s.db.NewIterator(util.BytesPrefix(levelDBRecordPrefix), nil)
+	defer it.Release()
+	for it.Next() {
+		entries[string(it.Key()[len(levelDBRecordPrefix):])] = copyBytes(it.Value())
+	}
+	return entries, it.Error()
+}
+
+// all changes are written in a single batch
+func (s *LevelDBStorage) SaveBatch(entries map[string][]byte, header []byte) error {
+	batch := new(leveldb.Batch)
+	for name, data := range entries {
+		if data == nil {
+			batch.Delete(levelDBRecordKey(name))
+		} else {
+			batch.Put(levelDBRecordKey(name), data)
+		}
+	}
+	if header != nil {
+		batch.Put(levelDBHeaderKey, header)
+	}
+	return s.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+func (s *LevelDBStorage) Close() error {
+	return s.db.Close()
+}
+
+func levelDBRecordKey(name string) []byte {
+	return append(append([]byte{}, levelDBRecordPrefix...), name...)
+}
@@ -0,0 +1,169 @@
+package wallet
+
+import (
+	"errors"
+	"github.com/coschain/cos-sdk-go/utils"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// storages of each kind in dir, opened again by reopen after closed
+var testStorages = []struct {
+	kind string
+	open func(dir string) (Storage, error)
+}{
+	{"file", func(dir string) (Storage, error) { return NewFileStorage(filepath.Join(dir, "test.key")) }},
+	{"dir", func(dir string) (Storage, error) { return NewDirStorage(filepath.Join(dir, "keystore")) }},
+	{"leveldb", func(dir string) (Storage, error) { return NewLevelDBStorage(filepath.Join(dir, "db")) }},
+}
+
+func TestStorages(t *testing.T) {
+	for _, kind := range testStorages {
+		dir := t.TempDir()
+		s, err := kind.open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := openTestStorage(t, s)
+		if err != nil {
+			t.Fatalf("%s: %v", kind.kind, err)
+		}
+		if err := w.Add("alice1", testKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add("bobby1", testKey2); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddContact("carol1", Metadata{Notes: "friend"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Remove("bobby1"); err != nil {
+			t.Fatal(err)
+		}
+		// locked while open
+		if _, err := kind.open(dir); err == nil {
+			t.Fatalf("%s: opened twice", kind.kind)
+		}
+		w.Close()
+
+		if s, err = kind.open(dir); err != nil {
+			t.Fatal(err)
+		}
+		names, err := s.List()
+		if err != nil || !reflect.DeepEqual(names, []string{contactKey("carol1"), "alice1"}) {
+			t.Fatalf("%s: got entries %v, error %v", kind.kind, names, err)
+		}
+		if w, err = openTestStorage(t, s); err != nil {
+			t.Fatalf("%s: %v", kind.kind, err)
+		}
+		if key, err := w.ExportPrivateKey("alice1"); err != nil || key != testKey {
+			t.Fatalf("%s: got key %s, error %v", kind.kind, key, err)
+		}
+		if len(w.GetAllAccounts()) != 1 || w.GetContact("carol1") == nil {
+			t.Fatalf("%s: got accounts %v", kind.kind, w.GetAllAccounts())
+		}
+	}
+}
+
+func TestWrongPasswordKeepsStorage(t *testing.T) {
+	s := NewMemStorage()
+	if _, err := openTestStorage(t, s); err != nil {
+		t.Fatal(err)
+	}
+	header, _ := s.LoadHeader()
+	w := NewKeyStoreWallet("127.0.0.1:1", utils.Dev)
+	if err := w.OpenStorage(s, "wrong"); err != ErrWrongPassword {
+		t.Fatalf("wrong password got %v", err)
+	}
+	if h, _ := s.LoadHeader(); string(h) != string(header) {
+		t.Fatal("header changed by a wrong password")
+	}
+}
+
+// a deleted entry, or one rolled back or moved, is reported, other accounts are still usable
+func TestDamagedRecords(t *testing.T) {
+	s := NewMemStorage()
+	w, err := openTestStorage(t, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]string{"alice1": testKey, "bobby1": testKey2, "carol1": testKey} {
+		if err := w.Add(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old, _ := s.Load("alice1")
+	if err := w.SetMetadata("alice1", Metadata{Notes: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	carol, _ := s.Load("carol1")
+	s.Save("alice1", old)
+	s.Delete("bobby1")
+	s.Save("dave01", carol)
+
+	w, err = openTestStorage(t, s)
+	var derr *DamagedRecordsError
+	if !errors.As(err, &derr) || !reflect.DeepEqual(derr.Names, []string{"alice1", "bobby1", "dave01"}) {
+		t.Fatalf("open got %v", err)
+	}
+	if !reflect.DeepEqual(w.DamagedRecords(), derr.Names) {
+		t.Fatalf("got damaged records %v", w.DamagedRecords())
+	}
+	if w.IsLocked() || len(w.GetAllAccounts()) != 1 || w.Account("carol1") == nil {
+		t.Fatalf("got accounts %v", w.GetAllAccounts())
+	}
+	// replaced and removed ones are not damaged any more
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove("bobby1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); !errors.As(err, &derr) || !reflect.DeepEqual(derr.Names, []string{"dave01"}) {
+		t.Fatalf("reload got %v", err)
+	}
+}
+
+// writes interrupted between an entry and the header are not reported as damaged
+func TestInterruptedWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keystore")
+	open := func() (*KeyStoreWallet, *failingStorage) {
+		ds, err := NewDirStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &failingStorage{DirStorage: ds}
+		w, err := openTestStorage(t, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w, s
+	}
+	w, s := open()
+	if err := w.Add("alice1", testKey); err != nil {
+		t.Fatal(err)
+	}
+	s.failHeader = true
+	if err := w.Add("bobby1", testKey2); err == nil {
+		t.Fatal("header failure is ignored")
+	}
+	w.Close()
+
+	w, s = open()
+	if w.Account("bobby1") == nil {
+		t.Fatal("account saved before the header is lost")
+	}
+	s.failDelete = true
+	if err := w.Remove("alice1"); err == nil {
+		t.Fatal("delete failure is ignored")
+	}
+	w.Close()
+
+	w, _ = open()
+	if w.Account("alice1") != nil || w.Account("bobby1") == nil || len(w.DamagedRecords()) != 0 {
+		t.Fatalf("got accounts %v, damaged %v", w.GetAllAccounts(), w.DamagedRecords())
+	}
+}
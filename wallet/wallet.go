@@ -0,0 +1,155 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/coschain/contentos-go/rpc/pb"
+	"github.com/coschain/cos-sdk-go/account"
+	"time"
+)
+
+// Wallet is the core of MemWallet and KeyStoreWallet, accounts management and signing,
+// write code against it so wallets can be swapped. other features are optional interfaces below
+type Wallet interface {
+	Querier
+
+	// key is checked against the chain unless the wallet imports offline, see WithOfflineImport
+	Add(name, privateKey string) error
+	AddByMnemonic(name, mnemonic string) error
+	ValidateKey(name, privateKey string) error
+	Remove(name string) error
+	// return nil if account is not in wallet
+	Account(name string) *account.Account
+	GetAllAccounts() map[string]*account.Account
+	GetRecord(name string) *Record
+	Close() error
+
+	GenerateNewKeyPair() (string, string, error)
+	GenerateNewMnemonic() (string, error)
+	GenerateKeyPairFromMnemonic(mnemonic string) (string, string, error)
+
+	DecryptMemo(name, memo string) (string, error)
+	VerifyMessage(name string, message []byte, signature string) (bool, error)
+	VerifyTransaction(trx *prototype.SignedTransaction) error
+	VerifyBlock(block *prototype.SignedBlock) error
+}
+
+// Importer adds accounts found on chain, watch-only accounts and keys in other formats
+type Importer interface {
+	// find accounts on chain and import them under their names
+	ImportByPrivateKey(privateKey string) (string, error)
+	ImportByMnemonic(mnemonic string, gapLimit int) ([]string, error)
+	DiscoverAccount(privateKey string) (*Record, error)
+	DiscoverAccounts(mnemonic string, gapLimit int) ([]*Record, error)
+	// track an account without private key, signing with it returns ErrWatchOnly
+	AddWatchOnly(name, publicKey string, labels ...string) error
+	IsWatchOnly(name string) bool
+	// private keys in raw hex, PEM or ethereum keystore v3 json
+	AddByHexKey(name, hexKey string) error
+	AddByPEM(name string, pemData []byte) error
+	AddByEthKeyStore(name string, keyJson []byte, passphrase string) error
+}
+
+// Organizer keeps labels, notes and tags of accounts, and an address book of external accounts
+type Organizer interface {
+	SetMetadata(name string, m Metadata) error
+	SearchRecords(query string) []*Record
+	RecordsByLabel(label string) []*Record
+	AddContact(name string, m Metadata) error
+	RemoveContact(name string) error
+	GetContact(name string) *Contact
+	GetAllContacts() []*Contact
+	SearchContacts(query string) []*Contact
+	ContactsByLabel(label string) []*Contact
+}
+
+// Exporter takes keys out of a wallet and brings them back
+type Exporter interface {
+	ExportPrivateKey(name string) (string, error)
+	// encrypted backup bundles with their own passphrase, restored into any wallet
+	ExportBackup(passphrase string, opts *BackupOptions) ([]byte, error)
+	RestoreBackup(data []byte, passphrase string, policy ConflictPolicy) (*RestoreResult, error)
+	// printable keys with checksum, private key is encrypted with passphrase
+	ExportPaperKey(name, passphrase string) (string, error)
+	ImportPaperKey(paperKey, passphrase string) (string, error)
+}
+
+// KeyRotator replaces the key of an account on chain and in wallet
+type KeyRotator interface {
+	RotateKey(name string, opts *RotateOptions) (string, error)
+	ResumeRotation(name string, timeout time.Duration) error
+}
+
+// PolicyEnforcer keeps spending policies checked by every operation of an account before signing
+type PolicyEnforcer interface {
+	SetPolicy(name string, p *SpendingPolicy) error
+	GetPolicy(name string) *SpendingPolicy
+	SpentToday(name string) uint64
+}
+
+// HealthChecker checks accounts in wallet against the chain
+type HealthChecker interface {
+	Doctor() (*HealthReport, error)
+}
+
+// Querier is the read-only chain queries of a wallet, no account in wallet is needed
+type Querier interface {
+	QueryTableContent(owner, contract, table, field string, count uint32, reverse bool) (*grpcpb.TableContentResponse, error)
+	GetAccountByName(name string) (*grpcpb.AccountResponse, error)
+	GetFollowerListByName(name string, pageSize uint32) (*PageManager, error)
+	GetFollowingListByName(name string, pageSize uint32) (*PageManager, error)
+	GetFollowCountByName(name string) (*grpcpb.GetFollowCountByNameResponse, error)
+	GetBlockProducerList(size uint32) (*grpcpb.GetBlockProducerListResponse, error)
+	GetPostListByCreated(startTime uint32, endTime uint32, limit uint32) (*grpcpb.GetPostListByCreatedResponse, error)
+	GetReplyListByPostId(postid uint64, startTime uint32, endTime uint32, limit uint32) (*grpcpb.GetReplyListByPostIdResponse, error)
+	GetBlockTransactionsByNum(blockNum uint32) (*grpcpb.GetBlockTransactionsByNumResponse, error)
+	GetChainState() (*grpcpb.GetChainStateResponse, error)
+	GetBlockList(start, end uint64, limit uint32) (*grpcpb.GetBlockListResponse, error)
+	GetSignedBlock(blockNum uint64) (*grpcpb.GetSignedBlockResponse, error)
+	GetAccountListByBalance(startCoin, endCoin uint64, pageSize uint32) (*PageManager, error)
+	GetDailyTotalTrxInfo(startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetTrxInfoById(trxId *prototype.Sha256) (*grpcpb.GetTrxInfoByIdResponse, error)
+	GetTrxListByTime(startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetPostListByCreateTime(startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetPostListByName(name string, pageSize uint32) (*PageManager, error)
+	TrxStatByHour(hours uint32) (*grpcpb.TrxStatByHourResponse, error)
+	GetUserTrxListByTime(name string, startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetPostInfoById(postId uint64) (*grpcpb.GetPostInfoByIdResponse, error)
+	GetContractInfo(owner, contract string) (*grpcpb.GetContractInfoResponse, error)
+	GetBlkIsIrreversibleByTxId(trxId *prototype.Sha256) (*grpcpb.GetBlkIsIrreversibleByTxIdResponse, error)
+	GetAccountListByCreTime(startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetDailyStats(dapp string, days uint32) (*grpcpb.GetDailyStatsResponse, error)
+	GetContractListByTime(startTime, endTime, pageSize uint32) (*PageManager, error)
+	GetBlockProducerListByVoteCount(pageSize uint32) (*PageManager, error)
+	GetPostListByVest(pageSize uint32) (*PageManager, error)
+	EstimateStamina(transaction *prototype.SignedTransaction) (*grpcpb.EsimateResponse, error)
+	GetNodeNeighbours() (*grpcpb.GetNodeNeighboursResponse, error)
+	GetMyStakers(name string, size uint32) (*grpcpb.GetMyStakerListByNameResponse, error)
+	GetMyStakes(name string, size uint32) (*grpcpb.GetMyStakeListByNameResponse, error)
+	GetNodeRunningVersion() (*grpcpb.GetNodeRunningVersionResponse, error)
+	GetAccountListByVest(pageSize uint32) (*PageManager, error)
+	GetBlockProducerByName(name string) (*grpcpb.BlockProducerResponse, error)
+	GetAccountByPubKey(pubKey string) (*grpcpb.AccountResponse, error)
+	GetBlockBFTInfoByNum(blockNum uint64) (*grpcpb.GetBlockBFTInfoByNumResponse, error)
+	GetAppTableRecord(table, key string) (*grpcpb.GetAppTableRecordResponse, error)
+	GetBlockProducerVoterList(name string) (*grpcpb.GetBlockProducerVoterListResponse, error)
+	GetVestDelegationOrders(name string, isLender bool, pageSize uint32) (*PageManager, error)
+}
+
+var (
+	_ Querier = (*BaseWallet)(nil)
+	_ Wallet  = (*MemWallet)(nil)
+	_ Wallet  = (*KeyStoreWallet)(nil)
+
+	_ Importer       = (*MemWallet)(nil)
+	_ Importer       = (*KeyStoreWallet)(nil)
+	_ Organizer      = (*MemWallet)(nil)
+	_ Organizer      = (*KeyStoreWallet)(nil)
+	_ Exporter       = (*MemWallet)(nil)
+	_ Exporter       = (*KeyStoreWallet)(nil)
+	_ KeyRotator     = (*MemWallet)(nil)
+	_ KeyRotator     = (*KeyStoreWallet)(nil)
+	_ PolicyEnforcer = (*MemWallet)(nil)
+	_ PolicyEnforcer = (*KeyStoreWallet)(nil)
+	_ HealthChecker  = (*MemWallet)(nil)
+	_ HealthChecker  = (*KeyStoreWallet)(nil)
+)
@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"github.com/coschain/contentos-go/prototype"
+	"github.com/kataras/go-errors"
+	"time"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid WIF public key")
+	ErrWatchOnly        = errors.New("account is watch-only, it has no private key to sign")
+)
+
+// create a record of a watch-only account, publicKey is optional
+// unless the wallet imports offline, the account must exist on chain, and an empty publicKey is filled with its on-chain key
+func (w *BaseWallet) newWatchOnlyRecord(name, publicKey string, labels []string) (*Record, error) {
+	var pubKey *prototype.PublicKeyType
+	if publicKey != "" {
+		k, err := prototype.PublicKeyFromWIF(publicKey)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		pubKey = k
+	}
+	r := &Record{
+		Name:        name,
+		PublicKey:   publicKey,
+		CreatedTime: time.Now().Unix(),
+		WatchOnly:   true,
+	}
+	if len(labels) > 0 {
+		r.Labels = append([]string{}, labels...)
+	}
+
+	if w.offlineImport {
+		return r, nil
+	}
+
+	res, err := w.GetAccountByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if res.Info == nil || res.Info.PublicKey == nil {
+		return nil, ErrAccountNotFound
+	}
+	if pubKey == nil {
+		r.PublicKey = res.Info.PublicKey.ToWIF()
+	} else if !res.Info.PublicKey.Equal(pubKey) {
+		return nil, &KeyMismatchError{Name: name, OnChainKey: res.Info.PublicKey.ToWIF(), Key: publicKey}
+	}
+	return r, nil
+}
+
+// return true if account name is in wallet as watch-only
+func (w *BaseWallet) IsWatchOnly(name string) bool {
+	w.dataMu.RLock()
+	defer w.dataMu.RUnlock()
+	r, ok := w.records[name]
+	return ok && r.WatchOnly
+}
+
+// track an account without its private key, it's listed with other accounts but signing returns ErrWatchOnly
+// return ErrAccountExists if a signing account of the same name is in wallet
+func (w *MemWallet) AddWatchOnly(name, publicKey string, labels ...string) error {
+	r, err := w.newWatchOnlyRecord(name, publicKey, labels)
+	if err != nil {
+		return err
+	}
+	w.dataMu.Lock()
+	defer w.dataMu.Unlock()
+	if w.records == nil {
+		return ErrWalletClosed
+	}
+	if old, ok := w.records[name]; ok && !old.WatchOnly {
+		return ErrAccountExists
+	}
+	w.setRecord(r)
+	return nil
+}
+
+// track an account without its private key, it's listed with other accounts but signing returns ErrWatchOnly
+// return ErrAccountExists if a signing account of the same name is in wallet
+func (w *KeyStoreWallet) AddWatchOnly(name, publicKey string, labels ...string) error {
+	r, err := w.newWatchOnlyRecord(name, publicKey, labels)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if old, ok := w.records[name]; ok && !old.WatchOnly {
+		return ErrAccountExists
+	}
+	return w.put(r)
+}
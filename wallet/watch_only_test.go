@@ -0,0 +1,84 @@
+package wallet
+
+import (
+	"errors"
+	"github.com/coschain/cos-sdk-go/utils"
+	"testing"
+)
+
+type watchingWallet interface {
+	Wallet
+	Importer
+}
+
+func TestWatchOnly(t *testing.T) {
+	node := newFakeNode(map[string]string{"alice1": testPubKey, "bobby1": testPubKey2})
+	ip := startNode(t, node)
+	ks := NewKeyStoreWallet(ip, utils.Dev)
+	ks.SetKdfParams(utils.KdfParams{N: 1 << 10, R: 8, P: 1})
+	if err := ks.OpenStorage(NewMemStorage(), "password"); err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+	mem := NewMemWallet(ip, utils.Dev)
+	defer mem.Close()
+
+	for _, w := range []watchingWallet{ks, mem} {
+		// key is filled with the on-chain one
+		if err := w.AddWatchOnly("bobby1", "", "cold"); err != nil {
+			t.Fatalf("%T: %v", w, err)
+		}
+		r := w.GetRecord("bobby1")
+		if !w.IsWatchOnly("bobby1") || r.PublicKey != testPubKey2 || !r.HasLabel("cold") {
+			t.Fatalf("%T: got record %+v", w, r)
+		}
+		if w.Account("bobby1") == nil {
+			t.Fatalf("%T: watch-only account is not listed", w)
+		}
+		if _, err := w.Account("bobby1").SignMessage([]byte("hello")); err != ErrWatchOnly {
+			t.Fatalf("%T: sign with watch-only account got %v", w, err)
+		}
+
+		if err := w.AddWatchOnly("bobby1", "bad key"); err != ErrInvalidPublicKey {
+			t.Fatalf("%T: invalid key got %v", w, err)
+		}
+		var mismatch *KeyMismatchError
+		if err := w.AddWatchOnly("bobby1", testPubKey); !errors.As(err, &mismatch) {
+			t.Fatalf("%T: another key got %v", w, err)
+		}
+		if err := w.AddWatchOnly("carol1", ""); err != ErrAccountNotFound {
+			t.Fatalf("%T: account not on chain got %v", w, err)
+		}
+
+		// a signing account is never downgraded, but a watch-only one is upgraded by its key
+		if err := w.Add("alice1", testKey); err != nil {
+			t.Fatalf("%T: %v", w, err)
+		}
+		if err := w.AddWatchOnly("alice1", testPubKey); err != ErrAccountExists {
+			t.Fatalf("%T: watch a signing account got %v", w, err)
+		}
+		if err := w.Add("bobby1", testKey2); err != nil {
+			t.Fatalf("%T: %v", w, err)
+		}
+		if w.IsWatchOnly("bobby1") {
+			t.Fatalf("%T: account is still watch-only after its key is added", w)
+		}
+	}
+}
+
+func TestWatchOnlySaved(t *testing.T) {
+	w := newTestKeyStoreWallet(t, "127.0.0.1:1")
+	if err := w.AddWatchOnly("bobby1", testPubKey2); err != nil {
+		t.Fatal(err)
+	}
+	w.Lock()
+	if err := w.Unlock("password", 0); err != nil {
+		t.Fatal(err)
+	}
+	if r := w.GetRecord("bobby1"); !w.IsWatchOnly("bobby1") || r.PublicKey != testPubKey2 {
+		t.Fatalf("got record %+v", r)
+	}
+	if _, err := w.ExportPrivateKey("bobby1"); err != ErrWatchOnly {
+		t.Fatalf("export watch-only account got %v", err)
+	}
+}